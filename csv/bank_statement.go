@@ -0,0 +1,80 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"invoicing-item-app/statement"
+)
+
+// ReadBankStatement reads a statement exported as CSV. Columns are expected in the order:
+// date, amount (negative for outgoing payments), counterparty name, counterparty account,
+// counterparty PIB, reference (poziv na broj), purpose.
+func ReadBankStatement(data []byte) ([]statement.Transaction, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.Comma = detectDelimiter(data)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading record: %v", err)
+	}
+
+	var transactions []statement.Transaction
+	for i, row := range rows {
+		if isBlankRow(row) {
+			continue
+		}
+		transaction, err := parseTransaction(row)
+		if err != nil {
+			// The first row is usually a header
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("error parsing row %d: %v", i+1, err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+func parseTransaction(record []string) (statement.Transaction, error) {
+	if len(record) < 2 {
+		return statement.Transaction{}, fmt.Errorf("invalid record length")
+	}
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	date, err := statement.ParseDate(field(0))
+	if err != nil {
+		return statement.Transaction{}, err
+	}
+	amount, err := ParseNumber(field(1))
+	if err != nil {
+		return statement.Transaction{}, fmt.Errorf("invalid amount: %v", err)
+	}
+
+	return statement.Transaction{
+		Date:      date,
+		Amount:    abs(amount),
+		Outgoing:  amount < 0,
+		Name:      field(2),
+		Account:   field(3),
+		PIB:       field(4),
+		Reference: field(5),
+		Purpose:   field(6),
+	}, nil
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package csv
+
+import (
+	"testing"
+	"time"
+
+	"invoicing-item-app/statement"
+)
+
+func TestReadBankStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []statement.Transaction
+		wantErr bool
+	}{
+		{
+			name: "header and semicolons",
+			data: "\xef\xbb\xbfDatum;Iznos;Naziv;Račun;PIB;Poziv na broj;Svrha\n" +
+				"05.03.2026;-1.250,50;Dobavljač DOO;160-5100-05;101134702;97 1226;Račun F-12/2026\n" +
+				";;;;;;\n" +
+				"2026-03-06;300,00;Kupac;;;;Povrat\n",
+			want: []statement.Transaction{
+				{Date: time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), Amount: 1250.50, Outgoing: true, Name: "Dobavljač DOO",
+					Account: "160-5100-05", PIB: "101134702", Reference: "97 1226", Purpose: "Račun F-12/2026"},
+				{Date: time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC), Amount: 300, Name: "Kupac", Purpose: "Povrat"},
+			},
+		},
+		{
+			name: "commas without header",
+			data: "07.03.2026,-99.90,Dobavljač\n",
+			want: []statement.Transaction{
+				{Date: time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC), Amount: 99.90, Outgoing: true, Name: "Dobavljač"},
+			},
+		},
+		{
+			name:    "invalid amount after the header",
+			data:    "Datum;Iznos\n05.03.2026;iznos\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		transactions, err := ReadBankStatement([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(transactions) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(transactions), len(tt.want))
+			continue
+		}
+		for i := range tt.want {
+			if transactions[i] != tt.want[i] {
+				t.Errorf("%s: transaction %d = %+v, want %+v", tt.name, i, transactions[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"invoicing-item-app/models"
 
@@ -19,12 +21,13 @@ const DefaultCSVFile = "artikli.csv"
 type ProductCsv struct {
 	ID        int
 	Name      string
-	TaxRate   int
+	VatRate   models.VatRate
 	PriceType int
 	Price     int
 }
 
-func ReadProductsFromCSV(filename string) ([]ProductCsv, error) {
+// ReadProductsFromCSV reads products, mapping the VAT register letters to the given rates
+func ReadProductsFromCSV(filename string, rates []models.VatRate) ([]ProductCsv, error) {
 	// Open the CSV file
 	file, err := os.Open(filename)
 	if err != nil {
@@ -54,7 +57,7 @@ func ReadProductsFromCSV(filename string) ([]ProductCsv, error) {
 		}
 
 		// Parse the record into ProductCsv
-		product, err := parseRecord(record)
+		product, err := parseRecord(record, rates)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing record: %v", err)
 		}
@@ -65,7 +68,7 @@ func ReadProductsFromCSV(filename string) ([]ProductCsv, error) {
 	return products, nil
 }
 
-func parseRecord(record []string) (ProductCsv, error) {
+func parseRecord(record []string, rates []models.VatRate) (ProductCsv, error) {
 	if len(record) < 14 {
 		return ProductCsv{}, fmt.Errorf("invalid record length")
 	}
@@ -79,15 +82,10 @@ func parseRecord(record []string) (ProductCsv, error) {
 	// Parse Name
 	name := strings.Trim(record[1], "\"")
 
-	// Parse VAT (TaxRate)
+	// Parse VAT register letter
 	vat := strings.Trim(record[2], "\"")
-	taxRate := 0
-	switch vat {
-	case "Ђ":
-		taxRate = 20
-	case "Е":
-		taxRate = 10
-	default:
+	vatRate, ok := models.VatRateByLabel(rates, vat, time.Now())
+	if !ok {
 		return ProductCsv{}, fmt.Errorf("invalid VAT code: %s", vat)
 	}
 
@@ -102,7 +100,7 @@ func parseRecord(record []string) (ProductCsv, error) {
 	return ProductCsv{
 		ID:        id,
 		Name:      name,
-		TaxRate:   taxRate,
+		VatRate:   vatRate,
 		PriceType: 1, // Always set to 1 as specified
 		Price:     price,
 	}, nil
@@ -110,10 +108,10 @@ func parseRecord(record []string) (ProductCsv, error) {
 
 func convertToItem(product ProductCsv) models.Item {
 	return models.Item{
-		Name:    product.Name,
-		Price:   float64(product.Price),
-		Unit:    "kom", // Default unit, adjust as needed
-		TaxRate: product.TaxRate,
+		Name:      product.Name,
+		Price:     float64(product.Price),
+		Unit:      "kom", // Default unit, adjust as needed
+		VatRateID: product.VatRate.ID,
 	}
 }
 
@@ -126,16 +124,8 @@ func ExportItemsToCSV(items []models.Item) ([]byte, error) {
 
 	// Write each item as a CSV row
 	for _, item := range items {
-		// Convert TaxRate to VAT code
-		var vatCode string
-		switch item.TaxRate {
-		case 20:
-			vatCode = "Ђ"
-		case 10:
-			vatCode = "Е"
-		default:
-			vatCode = ""
-		}
+		// Items are expected to be loaded with their VAT rate
+		vatCode := item.VatRate.Label
 
 		// Format the CSV row with semicolon delimiter
 		row := fmt.Sprintf("\"%d\";\"%s\";\"%s\";\"1\";\"%.2f\";\"0\";\"0\";\"0\";\"0\";\"\";\"\";\"\";\"\"\n",
@@ -146,7 +136,8 @@ func ExportItemsToCSV(items []models.Item) ([]byte, error) {
 	return []byte(output.String()), nil
 }
 
-func ImportItemsFromCSV(filename string, db *gorm.DB) error {
+// ImportItemsFromCSV replaces the items of the company with the ones in the file
+func ImportItemsFromCSV(filename string, db *gorm.DB, companyID uint) error {
 	// Read the source file
 	sourceFile, err := os.ReadFile(filename)
 	if err != nil {
@@ -159,12 +150,12 @@ func ImportItemsFromCSV(filename string, db *gorm.DB) error {
 	}
 
 	// Call Populate to import the items
-	Populate()
+	Populate(companyID)
 
 	return nil
 }
 
-func parseImportRecord(record []string) (models.Item, error) {
+func parseImportRecord(record []string, rates []models.VatRate) (models.Item, error) {
 	if len(record) < 13 {
 		return models.Item{}, fmt.Errorf("invalid record length")
 	}
@@ -172,15 +163,10 @@ func parseImportRecord(record []string) (models.Item, error) {
 	// Parse Name (column 1)
 	name := strings.Trim(record[1], "\"")
 
-	// Parse VAT (column 2) - convert to TaxRate
+	// Parse VAT (column 2) - look up the rate by register letter
 	vat := strings.Trim(record[2], "\"")
-	taxRate := 0
-	switch vat {
-	case "Ђ":
-		taxRate = 20
-	case "Е":
-		taxRate = 10
-	default:
+	vatRate, ok := models.VatRateByLabel(rates, vat, time.Now())
+	if !ok {
 		return models.Item{}, fmt.Errorf("invalid VAT code: %s", vat)
 	}
 
@@ -192,25 +178,37 @@ func parseImportRecord(record []string) (models.Item, error) {
 	}
 
 	return models.Item{
-		Name:    name,
-		Price:   price,
-		Unit:    record[3], // Default unit
-		TaxRate: taxRate,
+		Name:      name,
+		Price:     price,
+		Unit:      record[3], // Default unit
+		VatRateID: vatRate.ID,
 	}, nil
 }
 
-func Populate() {
+// Populate brings the items of a company in line with the products in DefaultCSVFile. Without a
+// company ID the items go to the first company. Items are matched by name and updated in place,
+// so documents and supplier mappings keep pointing at them. Items of other companies are left alone.
+func Populate(companyID uint) {
 	db, err := gorm.Open(sqlite.Open("invoicing.db"), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
-	db.AutoMigrate(&models.Company{}, &models.Item{}, &models.Supplier{}, &models.InvoiceItem{}, &models.Invoice{})
+	models.Migrate(db)
+
+	if companyID == 0 {
+		var company models.Company
+		if err := db.Order("id").First(&company).Error; err == nil {
+			companyID = company.ID
+		}
+	}
 
-	// Drop and recreate the items table to reset IDs
-	db.Migrator().DropTable(&models.Item{})
-	db.AutoMigrate(&models.Item{})
+	rates, err := models.LoadVatRates(db)
+	if err != nil {
+		fmt.Printf("Error loading VAT rates: %v\n", err)
+		return
+	}
 
-	products, err := ReadProductsFromCSV(DefaultCSVFile)
+	products, err := ReadProductsFromCSV(DefaultCSVFile, rates)
 	if err != nil {
 		fmt.Printf("Error reading CSV: %v\n", err)
 		return
@@ -218,21 +216,168 @@ func Populate() {
 
 	fmt.Printf("Found %d products to import\n", len(products))
 
+	var existing []models.Item
+	if err := db.Where("company_id = ?", companyID).Find(&existing).Error; err != nil {
+		fmt.Printf("Error loading items: %v\n", err)
+		return
+	}
+	byName := make(map[string]models.Item, len(existing))
+	for _, item := range existing {
+		byName[itemKey(item.Name)] = item
+	}
+
 	successCount := 0
 	errorCount := 0
+	var imported []uint
 
 	for _, p := range products {
 		item := convertToItem(p)
-
-		if err := db.Create(&item).Error; err != nil {
+		item.CompanyID = companyID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if current, ok := byName[itemKey(p.Name)]; ok {
+				item.ID = current.ID
+				if err := tx.Model(&current).Updates(map[string]interface{}{
+					"name":        item.Name,
+					"vat_rate_id": item.VatRateID,
+					"archived":    false,
+				}).Error; err != nil {
+					return err
+				}
+				// A changed price continues the item's price history
+				if current.Price == item.Price {
+					return nil
+				}
+			} else if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			return models.RecordPrice(tx, item.ID, item.Price, time.Now(), models.PriceSourceImport)
+		})
+		if err != nil {
 			fmt.Printf("Error importing item '%s': %v\n", p.Name, err)
 			errorCount++
 		} else {
-			fmt.Printf("✓ Imported: %s (Price: %.2f, Tax: %d%%)\n",
-				item.Name, item.Price, item.TaxRate)
+			fmt.Printf("✓ Imported: %s (Price: %.2f, Tax: %g%%)\n",
+				item.Name, item.Price, p.VatRate.Percent)
+			imported = append(imported, item.ID)
 			successCount++
 		}
 	}
 
+	if err := removeMissingItems(db, companyID, imported); err != nil {
+		fmt.Printf("Error removing old items: %v\n", err)
+	}
+
 	fmt.Printf("\nImport complete: %d successful, %d failed\n", successCount, errorCount)
 }
+
+// itemKey is the name an imported product is matched with
+func itemKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// removeMissingItems removes the items of a company that are no longer in the imported list.
+// Items that appear on documents are archived instead, the rest go with their price history
+// and supplier mappings.
+func removeMissingItems(db *gorm.DB, companyID uint, imported []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		missing := tx.Model(&models.Item{}).Where("company_id = ?", companyID)
+		if len(imported) > 0 {
+			missing = missing.Where("id NOT IN ?", imported)
+		}
+		var items []models.Item
+		if err := missing.Find(&items).Error; err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			hasDocuments, err := models.ItemHasDocuments(tx, item.ID)
+			if err != nil {
+				return err
+			}
+			if hasDocuments {
+				if err := tx.Model(&item).Update("archived", true).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Unscoped().Where("item_id = ?", item.ID).Delete(&models.ItemPrice{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("item_id = ?", item.ID).Delete(&models.SupplierItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ExportInvoiceSummaryToCSV lists the exported kalkulacije with their totals, one row per document,
+// followed by the selling value and VAT of every rate that appears in the period. Invoices are
+// expected to be loaded with their supplier and lines.
+func ExportInvoiceSummaryToCSV(invoices []models.Invoice) ([]byte, error) {
+	var output strings.Builder
+
+	// Every rate of the period gets a column pair, highest rate first like the recapitulation
+	var rates []models.VatRecap
+	recaps := make([][]models.VatRecap, len(invoices))
+	for i, invoice := range invoices {
+		recaps[i] = invoice.Recapitulation()
+		for _, recap := range recaps[i] {
+			if recapIndex(rates, recap) < 0 {
+				rates = append(rates, models.VatRecap{TaxLabel: recap.TaxLabel, TaxRate: recap.TaxRate})
+			}
+		}
+	}
+	sort.Slice(rates, func(a, b int) bool {
+		if rates[a].TaxRate != rates[b].TaxRate {
+			return rates[a].TaxRate > rates[b].TaxRate
+		}
+		return rates[a].TaxLabel < rates[b].TaxLabel
+	})
+
+	header := "No;File;Number;Date;Supplier;PIB;Document;Purchase Value;Margin;Selling Value;VAT;Total"
+	for _, rate := range rates {
+		name := strconv.FormatFloat(rate.TaxRate, 'f', -1, 64) + "%"
+		if rate.TaxLabel != "" {
+			name += " (" + rate.TaxLabel + ")"
+		}
+		header += fmt.Sprintf(";Base %s;VAT %s", name, name)
+	}
+	output.WriteString(header + "\n")
+
+	for i, invoice := range invoices {
+		row := fmt.Sprintf("\"%d\";\"%s\";\"%s\";\"%s\";\"%s\";\"%s\";\"%s\";\"%.2f\";\"%.2f\";\"%.2f\";\"%.2f\";\"%.2f\"",
+			i+1, InvoicePDFName(i+1, invoice), invoice.InternalNumber, invoice.Date.Format("02.01.2006"), invoice.Supplier.Name, invoice.Supplier.PIB,
+			invoice.DocumentNumber, invoice.Subtotal, invoice.Margin(), invoice.SellingValue(), invoice.TaxAmount, invoice.Total)
+		output.WriteString(row)
+		for _, rate := range rates {
+			var base, tax float64
+			if j := recapIndex(recaps[i], rate); j >= 0 {
+				base, tax = recaps[i][j].Base, recaps[i][j].TaxAmount
+			}
+			output.WriteString(fmt.Sprintf(";\"%.2f\";\"%.2f\"", base, tax))
+		}
+		output.WriteString("\n")
+	}
+
+	return []byte(output.String()), nil
+}
+
+// recapIndex finds the recapitulation row of the same VAT rate
+func recapIndex(recap []models.VatRecap, rate models.VatRecap) int {
+	for i := range recap {
+		if recap[i].TaxRate == rate.TaxRate && recap[i].TaxLabel == rate.TaxLabel {
+			return i
+		}
+	}
+	return -1
+}
+
+// InvoicePDFName is the file name of a kalkulacija inside a period export
+func InvoicePDFName(number int, invoice models.Invoice) string {
+	return fmt.Sprintf("%03d-kalkulacija-%d.pdf", number, invoice.ID)
+}
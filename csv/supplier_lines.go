@@ -0,0 +1,134 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"invoicing-item-app/xlsx"
+)
+
+// SupplierLine is a single line of a supplier invoice read from an uploaded file.
+// Columns are expected in the order: article code, name, quantity, price, discount.
+type SupplierLine struct {
+	Code     string
+	Name     string
+	Quantity float64
+	Price    float64
+	Discount float64
+}
+
+// ReadSupplierLines reads the lines of an uploaded CSV or XLSX file, the name only tells the format
+func ReadSupplierLines(data []byte, filename string) ([]SupplierLine, error) {
+	var rows [][]string
+	var err error
+	if strings.EqualFold(filepath.Ext(filename), ".xlsx") {
+		rows, err = xlsx.ReadRows(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.Comma = detectDelimiter(data)
+		reader.LazyQuotes = true
+		reader.FieldsPerRecord = -1
+		rows, err = reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %v", err)
+		}
+	}
+
+	var lines []SupplierLine
+	for i, row := range rows {
+		if isBlankRow(row) {
+			continue
+		}
+		line, err := parseSupplierLine(row)
+		if err != nil {
+			// The first row is usually a header
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("error parsing row %d: %v", i+1, err)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func parseSupplierLine(record []string) (SupplierLine, error) {
+	if len(record) < 4 {
+		return SupplierLine{}, fmt.Errorf("invalid record length")
+	}
+
+	code := strings.TrimSpace(record[0])
+	name := strings.TrimSpace(record[1])
+	if code == "" && name == "" {
+		return SupplierLine{}, fmt.Errorf("missing article code and name")
+	}
+
+	quantity, err := ParseNumber(record[2])
+	if err != nil {
+		return SupplierLine{}, fmt.Errorf("invalid quantity: %v", err)
+	}
+
+	price, err := ParseNumber(record[3])
+	if err != nil {
+		return SupplierLine{}, fmt.Errorf("invalid price: %v", err)
+	}
+
+	discount := 0.0
+	if len(record) > 4 && strings.TrimSpace(record[4]) != "" {
+		discount, err = ParseNumber(strings.TrimSuffix(strings.TrimSpace(record[4]), "%"))
+		if err != nil {
+			return SupplierLine{}, fmt.Errorf("invalid discount: %v", err)
+		}
+	}
+
+	return SupplierLine{
+		Code:     code,
+		Name:     name,
+		Quantity: quantity,
+		Price:    price,
+		Discount: discount,
+	}, nil
+}
+
+// ParseNumber parses both "1234.56" and the local "1.234,56" notation.
+func ParseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(strings.Trim(s, "\""))
+	s = strings.ReplaceAll(s, " ", "")
+	if strings.Contains(s, ",") {
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.ReplaceAll(s, ",", ".")
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func detectDelimiter(data []byte) rune {
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if bytes.Count(firstLine, []byte(";")) >= bytes.Count(firstLine, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+func isBlankRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
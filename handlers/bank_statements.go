@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"invoicing-item-app/csv"
+	"invoicing-item-app/models"
+	"invoicing-item-app/statement"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Matches scoring at least this much are recorded as payments without review
+const autoMatchScore = 6
+
+// ImportStatement reads a bank statement (camt.053 or Halcom XML, or CSV), records the outgoing payments
+// that clearly belong to an open invoice and keeps the rest for review.
+func (h *PaymentHandler) ImportStatement(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error getting file: %v", err)
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error opening file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	var transactions []statement.Transaction
+	data, err := io.ReadAll(f)
+	if err == nil {
+		if strings.EqualFold(filepath.Ext(file.Filename), ".xml") {
+			transactions, err = statement.ParseXML(data)
+		} else {
+			transactions, err = csv.ReadBankStatement(data)
+		}
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error reading statement: %v", err)
+		return
+	}
+
+	openInvoices, err := h.openInvoices(c)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load invoices: " + err.Error(),
+		})
+		return
+	}
+
+	imported, matched := 0, 0
+	for _, t := range transactions {
+		if !t.Outgoing {
+			continue
+		}
+
+		transaction := models.BankTransaction{
+			CompanyID: activeCompany(c).ID,
+			Date:      t.Date,
+			Amount:    t.Amount,
+			Name:      t.Name,
+			Account:   models.NormalizeBankAccount(t.Account),
+			PIB:       t.PIB,
+			Reference: t.Reference,
+			Purpose:   t.Purpose,
+			Status:    models.TransactionUnmatched,
+		}
+
+		// Statements overlap when imported for consecutive periods
+		var count int64
+		h.DB.Model(&models.BankTransaction{}).Scopes(inCompany(c)).Where("date = ? AND amount = ? AND account = ? AND reference = ? AND name = ? AND purpose = ?",
+			transaction.Date, transaction.Amount, transaction.Account, transaction.Reference, transaction.Name, transaction.Purpose).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			invoice, score, reasons, unique := bestMatch(openInvoices, transaction)
+			if invoice != nil {
+				transaction.InvoiceID = &invoice.ID
+				transaction.Score = score
+				transaction.Reasons = strings.Join(reasons, ", ")
+				transaction.Status = models.TransactionSuggested
+				if unique && score >= autoMatchScore && transaction.Amount <= invoice.Outstanding()+0.005 {
+					payment, err := recordTransactionPayment(tx, &transaction)
+					if err != nil {
+						return err
+					}
+					invoice.Payments = append(invoice.Payments, payment)
+					matched++
+				}
+			}
+			return tx.Create(&transaction).Error
+		})
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not import transaction: " + err.Error(),
+			})
+			return
+		}
+		imported++
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("/payments/statement?imported=%d&matched=%d", imported, matched))
+}
+
+// openInvoices loads completed invoices that are not fully paid, oldest due first
+func (h *PaymentHandler) openInvoices(c *gin.Context) ([]*models.Invoice, error) {
+	var invoices []models.Invoice
+	err := h.DB.Scopes(inCompany(c)).Preload("Supplier.BankAccounts").Preload("Payments").
+		Where("completed_at IS NOT NULL").Order("due_date, id").Find(&invoices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var open []*models.Invoice
+	for i := range invoices {
+		if invoices[i].Outstanding() > 0 {
+			open = append(open, &invoices[i])
+		}
+	}
+	return open, nil
+}
+
+// bestMatch scores every open invoice against the transaction and returns the best one,
+// whether no other invoice scored the same, and what the score was based on
+func bestMatch(invoices []*models.Invoice, transaction models.BankTransaction) (*models.Invoice, int, []string, bool) {
+	var best *models.Invoice
+	var bestReasons []string
+	bestScore, ties := 0, 0
+	for _, invoice := range invoices {
+		if invoice.Outstanding() <= 0 {
+			continue
+		}
+		score, reasons := matchScore(invoice, transaction)
+		switch {
+		case score > bestScore:
+			best, bestScore, bestReasons, ties = invoice, score, reasons, 0
+		case score == bestScore && score > 0:
+			ties++
+		}
+	}
+	// A single hint such as the amount alone is not worth suggesting, at least two have to agree
+	if len(bestReasons) < 2 {
+		return nil, 0, nil, false
+	}
+	return best, bestScore, bestReasons, ties == 0
+}
+
+func matchScore(invoice *models.Invoice, transaction models.BankTransaction) (int, []string) {
+	score := 0
+	var reasons []string
+
+	if math.Abs(invoice.Outstanding()-transaction.Amount) < 0.01 {
+		score += 3
+		reasons = append(reasons, "iznos")
+	}
+	if transaction.PIB != "" && transaction.PIB == invoice.Supplier.PIB {
+		score += 3
+		reasons = append(reasons, "PIB")
+	}
+	if transaction.Account != "" {
+		for _, account := range invoice.Supplier.BankAccounts {
+			if account.Number == transaction.Account {
+				score += 3
+				reasons = append(reasons, "račun")
+				break
+			}
+		}
+	}
+	if number := alphanumeric(invoice.DocumentNumber); len(number) >= 3 &&
+		(strings.Contains(alphanumeric(transaction.Reference), number) || strings.Contains(alphanumeric(transaction.Purpose), number)) {
+		score += 4
+		reasons = append(reasons, "poziv na broj")
+	}
+	return score, reasons
+}
+
+// alphanumeric keeps only letters and digits, so that "F-12/2026" and "97 F12 2026" compare equal
+func alphanumeric(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// recordTransactionPayment books the transaction as a payment of its invoice
+func recordTransactionPayment(tx *gorm.DB, transaction *models.BankTransaction) (models.Payment, error) {
+	reference := transaction.Reference
+	if reference == "" {
+		reference = transaction.Purpose
+	}
+	payment := models.Payment{
+		InvoiceID: *transaction.InvoiceID,
+		Date:      transaction.Date,
+		Amount:    transaction.Amount,
+		Method:    "virman",
+		Reference: reference,
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return payment, err
+	}
+	transaction.PaymentID = &payment.ID
+	transaction.Status = models.TransactionMatched
+	return payment, nil
+}
+
+// GetStatementReview lists imported transactions waiting for confirmation or manual pairing
+func (h *PaymentHandler) GetStatementReview(c *gin.Context) {
+	var transactions []models.BankTransaction
+	err := h.DB.Scopes(inCompany(c)).Preload("Invoice.Supplier").
+		Where("status IN ?", []string{models.TransactionSuggested, models.TransactionUnmatched}).
+		Order("date, id").Find(&transactions).Error
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load transactions: " + err.Error(),
+		})
+		return
+	}
+
+	openInvoices, err := h.openInvoices(c)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load invoices: " + err.Error(),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"statementReview": true,
+		"transactions":    transactions,
+		"openInvoices":    openInvoices,
+		"imported":        c.Query("imported"),
+		"matched":         c.Query("matched"),
+		"active":          "payables",
+		"Title":           "Bank Statement",
+	})
+}
+
+// ConfirmTransaction records a reviewed transaction as payment of the selected invoice
+func (h *PaymentHandler) ConfirmTransaction(c *gin.Context) {
+	var transaction models.BankTransaction
+	if err := h.DB.Scopes(inCompany(c)).First(&transaction, paramID(c, "id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if transaction.Status == models.TransactionMatched {
+		c.String(http.StatusConflict, "Transaction is already matched")
+		return
+	}
+
+	invoiceID, _ := strconv.Atoi(c.PostForm("invoice_id"))
+	var invoice models.Invoice
+	if err := h.DB.Scopes(inCompany(c)).Preload("Payments").Where("completed_at IS NOT NULL").First(&invoice, invoiceID).Error; err != nil {
+		c.String(http.StatusBadRequest, "Please select an invoice")
+		return
+	}
+	if transaction.Amount > invoice.Outstanding()+0.005 {
+		c.String(http.StatusBadRequest, "Amount is larger than the outstanding %.2f", invoice.Outstanding())
+		return
+	}
+
+	transaction.InvoiceID = &invoice.ID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := recordTransactionPayment(tx, &transaction); err != nil {
+			return err
+		}
+		return tx.Omit("Invoice").Save(&transaction).Error
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// IgnoreTransaction marks a transaction that is not a supplier invoice payment
+func (h *PaymentHandler) IgnoreTransaction(c *gin.Context) {
+	result := h.DB.Model(&models.BankTransaction{}).Scopes(inCompany(c)).Where("id = ? AND status <> ?", paramID(c, "id"), models.TransactionMatched).
+		Update("status", models.TransactionIgnored)
+	if result.Error != nil {
+		c.String(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	c.String(http.StatusOK, "")
+}
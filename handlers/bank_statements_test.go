@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"testing"
+
+	"invoicing-item-app/models"
+)
+
+func TestBestMatch(t *testing.T) {
+	supplier := models.Supplier{
+		PIB:          "101134702",
+		BankAccounts: []models.SupplierBankAccount{{Number: "160000000000510005"}},
+	}
+	invoice := func(id uint, documentNumber string, total float64, payments ...float64) *models.Invoice {
+		inv := &models.Invoice{DocumentNumber: documentNumber, SupplierTotal: total, Supplier: supplier}
+		inv.ID = id
+		for _, amount := range payments {
+			inv.Payments = append(inv.Payments, models.Payment{Amount: amount})
+		}
+		return inv
+	}
+
+	tests := []struct {
+		name        string
+		invoices    []*models.Invoice
+		transaction models.BankTransaction
+		wantID      uint
+		wantScore   int
+		wantUnique  bool
+	}{
+		{
+			name:        "amount and reference",
+			invoices:    []*models.Invoice{invoice(1, "F-12/2026", 1000), invoice(2, "F-13/2026", 2000)},
+			transaction: models.BankTransaction{Amount: 1000, Reference: "97 F12 2026"},
+			wantID:      1, wantScore: 7, wantUnique: true,
+		},
+		{
+			name:        "outstanding amount after a partial payment",
+			invoices:    []*models.Invoice{invoice(1, "F-12/2026", 1000, 400)},
+			transaction: models.BankTransaction{Amount: 600, PIB: "101134702"},
+			wantID:      1, wantScore: 6, wantUnique: true,
+		},
+		{
+			name:        "amount alone is not enough",
+			invoices:    []*models.Invoice{invoice(1, "F-12/2026", 1000)},
+			transaction: models.BankTransaction{Amount: 1000},
+		},
+		{
+			name:        "paid invoices are skipped",
+			invoices:    []*models.Invoice{invoice(1, "F-12/2026", 1000, 1000)},
+			transaction: models.BankTransaction{Amount: 1000, Reference: "F-12/2026"},
+		},
+		{
+			name:        "two invoices with the same score",
+			invoices:    []*models.Invoice{invoice(1, "F-12/2026", 500), invoice(2, "F-14/2026", 500)},
+			transaction: models.BankTransaction{Amount: 500, Account: "160000000000510005"},
+			wantID:      1, wantScore: 6, wantUnique: false,
+		},
+	}
+	for _, tt := range tests {
+		best, score, _, unique := bestMatch(tt.invoices, tt.transaction)
+		var id uint
+		if best != nil {
+			id = best.ID
+		}
+		if id != tt.wantID || score != tt.wantScore || unique != tt.wantUnique {
+			t.Errorf("%s: got invoice %d, score %d, unique %v, want invoice %d, score %d, unique %v",
+				tt.name, id, score, unique, tt.wantID, tt.wantScore, tt.wantUnique)
+		}
+	}
+}
@@ -16,30 +16,52 @@ func NewCompanyHandler(db *gorm.DB) *CompanyHandler {
 	return &CompanyHandler{DB: db}
 }
 
+// GetCompany shows the active company, or an empty form for a new one
 func (h *CompanyHandler) GetCompany(c *gin.Context) {
 	var company models.Company
-	if err := h.DB.First(&company).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
-			c.String(http.StatusInternalServerError, err.Error())
-			return
-		}
-		// No company exists, render empty form
+	value, exists := c.Get(companyKey)
+	isNew := !exists || c.Query("new") == "true"
+	if isNew {
+		company.VatPayer = true
+		company.NumberFormat = models.DefaultNumberFormat
+		company.PriceDeviationPercent = models.DefaultPriceDeviationPercent
+	} else {
+		company = value.(models.Company)
+	}
+
+	// Report identifiers saved before they were validated
+	var errors map[string]string
+	if company.ID != 0 {
+		errors = company.Validate()
 	}
 
 	// If this is an HTMX request, render only the form partial
 	if c.GetHeader("HX-Request") == "true" {
 		c.HTML(http.StatusOK, "company.html", gin.H{
 			"company": company,
+			"errors":  errors,
+			"new":     isNew,
 		})
 		return
 	}
 
-	// Otherwise, render the full page
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"company": company,
-		"active":  "company",
-		"Title":   "Company",
-	})
+	// Otherwise, render the full page with the images printed on documents
+	data := gin.H{}
+	if !isNew {
+		var err error
+		if data, err = h.companyImagesData(company.ID); err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not load company images: " + err.Error(),
+			})
+			return
+		}
+	}
+	data["company"] = company
+	data["errors"] = errors
+	data["new"] = isNew
+	data["active"] = "company"
+	data["Title"] = "Company"
+	c.HTML(http.StatusOK, "index.html", data)
 }
 
 func (h *CompanyHandler) UpsertCompany(c *gin.Context) {
@@ -48,33 +70,68 @@ func (h *CompanyHandler) UpsertCompany(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Bad request")
 		return
 	}
+	company.ID = 0
+
+	value, exists := c.Get(companyKey)
+	isNew := !exists || c.PostForm("new") == "true"
 
-	var existingCompany models.Company
-	if err := h.DB.First(&existingCompany).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Create new company
-			if err := h.DB.Create(&company).Error; err != nil {
-				c.String(http.StatusInternalServerError, err.Error())
-				return
+	if company.NumberFormat == "" {
+		company.NumberFormat = models.DefaultNumberFormat
+	}
+	// An entered 0 turns the warning off, only a missing value takes the default
+	if c.PostForm("PriceDeviationPercent") == "" {
+		company.PriceDeviationPercent = models.DefaultPriceDeviationPercent
+	}
+	company.TrimIdentifiers()
+	errors := company.Validate()
+	if !models.ValidNumberFormat(company.NumberFormat) {
+		errors["NumberFormat"] = "Format mora sadržati redni broj, npr. {NNNN}"
+	}
+	if len(errors) > 0 {
+		c.HTML(http.StatusUnprocessableEntity, "company.html", gin.H{
+			"company": company,
+			"errors":  errors,
+			"new":     isNew,
+		})
+		return
+	}
+
+	if isNew {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&company).Error; err != nil {
+				return err
 			}
-			// Render only the form partial for HTMX
-			c.HTML(http.StatusCreated, "company.html", gin.H{
-				"company": company,
-			})
+			// The first company takes over everything entered before it existed
+			if !exists {
+				return models.AssignOrphans(tx, company.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
 			return
 		}
-		c.String(http.StatusInternalServerError, err.Error())
+
+		// Continue working in the new company, the whole page shows its data
+		c.SetCookie(companyCookie, uintString(company.ID), 365*24*60*60, "/", "", false, true)
+		c.Header("HX-Redirect", "/company")
+		c.Status(http.StatusCreated)
 		return
 	}
 
-	// Update existing company
+	// Update the active company
+	existingCompany := value.(models.Company)
 	existingCompany.Code = company.Code
+	existingCompany.RegistrationNumber = company.RegistrationNumber
 	existingCompany.SectorCode = company.SectorCode
 	existingCompany.Sector = company.Sector
 	existingCompany.Name = company.Name
 	existingCompany.Address = company.Address
 	existingCompany.Owner = company.Owner
 	existingCompany.User = company.User
+	existingCompany.PriceDeviationPercent = company.PriceDeviationPercent
+	existingCompany.VatPayer = company.VatPayer
+	existingCompany.NumberFormat = company.NumberFormat
 	if err := h.DB.Save(&existingCompany).Error; err != nil {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
@@ -85,3 +142,31 @@ func (h *CompanyHandler) UpsertCompany(c *gin.Context) {
 		"company": existingCompany,
 	})
 }
+
+// GetCompanySwitcher renders the picker of the active company shown in the navigation bar
+func (h *CompanyHandler) GetCompanySwitcher(c *gin.Context) {
+	var companies []models.Company
+	h.DB.Order("name").Find(&companies)
+
+	var activeID uint
+	if value, exists := c.Get(companyKey); exists {
+		activeID = value.(models.Company).ID
+	}
+	c.HTML(http.StatusOK, "company-switcher.html", gin.H{
+		"companies": companies,
+		"activeID":  activeID,
+	})
+}
+
+// SelectCompany switches the browser to another company
+func (h *CompanyHandler) SelectCompany(c *gin.Context) {
+	id, ok := parseID(c.PostForm("company_id"))
+	var company models.Company
+	if !ok || h.DB.First(&company, id).Error != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.SetCookie(companyCookie, uintString(company.ID), 365*24*60*60, "/", "", false, true)
+	// Lists and open documents of the previous company make no sense in the new one
+	c.Redirect(http.StatusFound, "/invoices")
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strconv"
+
+	"invoicing-item-app/models"
+	"invoicing-item-app/pdf"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Largest accepted image upload
+const maxImageSize = 2 << 20
+
+// Largest accepted width and height of an image in pixels, larger pictures only bloat the PDF files
+const maxImagePixels = 4000
+
+const pointsPerMillimetre = 72 / 25.4
+
+// placedImage is a company image embedded into a PDF with its printed height in points
+type placedImage struct {
+	*pdf.Image
+	Position string
+	Height   float64
+}
+
+// documentImages are the company images of a PDF by kind
+type documentImages map[string]placedImage
+
+// loadDocumentImages embeds the images of the company into the document
+func loadDocumentImages(db *gorm.DB, doc *pdf.Document, companyID uint) (documentImages, error) {
+	stored, err := models.CompanyImages(db, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return embedImages(doc, stored)
+}
+
+// embedImages adds already loaded company images to the document
+func embedImages(doc *pdf.Document, stored map[string]models.CompanyImage) (documentImages, error) {
+	images := make(documentImages, len(stored))
+	for kind, companyImage := range stored {
+		img, err := doc.AddImage(companyImage.Data)
+		if err != nil {
+			return nil, err
+		}
+		images[kind] = placedImage{Image: img, Position: companyImage.Position, Height: companyImage.Height * pointsPerMillimetre}
+	}
+	return images, nil
+}
+
+// imageLoader reads and embeds the images of the kalkulacije of an export. Every picture is read
+// once per export and embedded once per document, however many kalkulacije print it.
+type imageLoader struct {
+	db *gorm.DB
+	// Images of kalkulacije posted before the images were part of the snapshot
+	current map[string]models.CompanyImage
+	// Picture data by image version
+	versions map[uint][]byte
+
+	doc      *pdf.Document
+	embedded map[string]*pdf.Image
+}
+
+func newImageLoader(db *gorm.DB) *imageLoader {
+	return &imageLoader{db: db, versions: make(map[uint][]byte)}
+}
+
+// load returns the images the invoice is printed with, including their data
+func (l *imageLoader) load(invoice models.Invoice) (map[string]models.CompanyImage, error) {
+	if !invoice.HasSnapshot() {
+		if l.current == nil {
+			current, err := models.CompanyImages(l.db, invoice.CompanyID)
+			if err != nil {
+				return nil, err
+			}
+			l.current = current
+		}
+		return l.current, nil
+	}
+
+	images, err := models.InvoiceImages(l.db, invoice, false)
+	if err != nil {
+		return nil, err
+	}
+	for kind, image := range images {
+		data, ok := l.versions[image.ID]
+		if !ok {
+			var version models.ImageVersion
+			if err := l.db.First(&version, image.ID).Error; err != nil {
+				return nil, err
+			}
+			data = version.Data
+			l.versions[image.ID] = data
+		}
+		image.Data = data
+		images[kind] = image
+	}
+	return images, nil
+}
+
+// embed adds the images of the invoice to the document, reusing pictures already embedded in it
+func (l *imageLoader) embed(doc *pdf.Document, invoice models.Invoice) (documentImages, error) {
+	stored, err := l.load(invoice)
+	if err != nil {
+		return nil, err
+	}
+	if doc != l.doc {
+		l.doc, l.embedded = doc, make(map[string]*pdf.Image)
+	}
+
+	images := make(documentImages, len(stored))
+	for kind, companyImage := range stored {
+		key := fmt.Sprintf("%t/%d", invoice.HasSnapshot(), companyImage.ID)
+		img, ok := l.embedded[key]
+		if !ok {
+			if img, err = doc.AddImage(companyImage.Data); err != nil {
+				return nil, err
+			}
+			l.embedded[key] = img
+		}
+		images[kind] = placedImage{Image: img, Position: companyImage.Position, Height: companyImage.Height * pointsPerMillimetre}
+	}
+	return images, nil
+}
+
+// drawStampAndSignature draws the stamp centered on a signature line and the signature standing on it
+func drawStampAndSignature(page *pdf.Page, images documentImages, lineY, stampX, signatureX float64) {
+	if stamp, ok := images[models.ImageStamp]; ok {
+		page.Image(stamp.Image, stampX-stamp.ScaledWidth(stamp.Height)/2, lineY-stamp.Height/2, stamp.Height)
+	}
+	if signature, ok := images[models.ImageSignature]; ok {
+		page.Image(signature.Image, signatureX-signature.ScaledWidth(signature.Height)/2, lineY-signature.Height, signature.Height)
+	}
+}
+
+// companyImagesData returns the template data of the company images section
+func (h *CompanyHandler) companyImagesData(companyID uint) (gin.H, error) {
+	images, err := models.CompanyImages(h.DB.Omit("Data"), companyID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"images":     images,
+		"imageKinds": models.ImageKinds,
+	}, nil
+}
+
+// GetCompanyImage serves a logo, stamp or signature of the active company
+func (h *CompanyHandler) GetCompanyImage(c *gin.Context) {
+	value, exists := c.Get(companyKey)
+	if !exists {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var companyImage models.CompanyImage
+	err := h.DB.Where("company_id = ? AND kind = ?", value.(models.Company).ID, c.Param("kind")).First(&companyImage).Error
+	if err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.Data(http.StatusOK, companyImage.ContentType, companyImage.Data)
+}
+
+// UploadCompanyImage stores a logo, stamp or signature of the active company together with where
+// it is printed. The position and size can be changed later without uploading the picture again.
+func (h *CompanyHandler) UploadCompanyImage(c *gin.Context) {
+	value, exists := c.Get(companyKey)
+	kind, known := models.ImageKindByName(c.Param("kind"))
+	if !exists || !known {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	company := value.(models.Company)
+
+	var companyImage models.CompanyImage
+	err := h.DB.Where("company_id = ? AND kind = ?", company.ID, kind.Kind).First(&companyImage).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	companyImage.CompanyID = company.ID
+	companyImage.Kind = kind.Kind
+
+	companyImage.Position = c.PostForm("position")
+	if companyImage.Position != models.PositionLeft && companyImage.Position != models.PositionRight {
+		companyImage.Position = kind.Position
+	}
+	companyImage.Height, err = strconv.ParseFloat(c.PostForm("height"), 64)
+	if err != nil || companyImage.Height < 5 || companyImage.Height > 60 {
+		c.String(http.StatusBadRequest, "Visina slike mora biti između 5 i 60 mm")
+		return
+	}
+
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxImageSize {
+			c.String(http.StatusBadRequest, "Slika je veća od 2 MB")
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error opening file: %v", err)
+			return
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error reading file: %v", err)
+			return
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || (format != "png" && format != "jpeg") {
+			c.String(http.StatusBadRequest, "Slika mora biti u PNG ili JPEG formatu")
+			return
+		}
+		if config.Width > maxImagePixels || config.Height > maxImagePixels {
+			c.String(http.StatusBadRequest, "Slika je veća od 4000 piksela")
+			return
+		}
+		companyImage.Data = data
+		companyImage.ContentType = http.DetectContentType(data)
+	} else if companyImage.ID == 0 {
+		c.String(http.StatusBadRequest, "Izaberite sliku")
+		return
+	}
+
+	if err := h.DB.Save(&companyImage).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, "/company")
+}
+
+// DeleteCompanyImage removes a logo, stamp or signature, documents are printed without it
+func (h *CompanyHandler) DeleteCompanyImage(c *gin.Context) {
+	value, exists := c.Get(companyKey)
+	if !exists {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	companyID := value.(models.Company).ID
+
+	err := h.DB.Unscoped().Where("company_id = ? AND kind = ?", companyID, c.Param("kind")).Delete(&models.CompanyImage{}).Error
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data, err := h.companyImagesData(companyID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusOK, "company-images.html", data)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"invoicing-item-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetInvoiceCloneForm asks for the supplier, document number and date of the copy
+func (ic *InvoiceHandler) GetInvoiceCloneForm(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).Preload("Supplier").Preload("LineItems", models.OrderedLines).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+
+	var suppliers []models.Supplier
+	if err := ic.DB.Scopes(inCompany(c), models.Active).Find(&suppliers).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load suppliers: " + err.Error(),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"cloneSource": invoice,
+		"suppliers":   suppliers,
+		"TodayDate":   time.Now().Format("2006-01-02"),
+		"active":      "invoices",
+		"Title":       "Duplicate Invoice",
+	})
+}
+
+// CloneInvoice creates a new draft with the lines of an existing invoice. Selling prices are taken
+// as valid on the new date and purchase terms from the last delivery of the chosen supplier.
+func (ic *InvoiceHandler) CloneInvoice(c *gin.Context) {
+	var source models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).Preload("LineItems", models.OrderedLines).First(&source, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+
+	supplierID, err := strconv.Atoi(c.PostForm("supplier_id"))
+	if err != nil || supplierID == 0 {
+		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
+			"error": "Please select a supplier",
+		})
+		return
+	}
+	if !inActiveCompany(ic.DB, c, &models.Supplier{}, supplierID) {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Supplier not found",
+		})
+		return
+	}
+
+	documentNumber := c.PostForm("document_number")
+	if documentNumber == "" {
+		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
+			"error": "Please enter a document number",
+		})
+		return
+	}
+
+	invoiceDate, err := time.Parse("2006-01-02", c.PostForm("date"))
+	if err != nil {
+		invoiceDate = time.Now()
+	}
+
+	if existing, found, err := findDuplicateInvoice(ic.DB.Scopes(inCompany(c)), uint(supplierID), documentNumber, invoiceDate); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not check document number: " + err.Error(),
+		})
+		return
+	} else if found {
+		duplicateInvoiceError(c, existing)
+		return
+	}
+
+	invoice := models.Invoice{
+		CompanyID:      activeCompany(c).ID,
+		SupplierID:     uint(supplierID),
+		LocationID:     activeLocationID(ic.DB, c),
+		DocumentNumber: documentNumber,
+		Date:           invoiceDate,
+		DueDate:        models.DefaultDueDate(ic.DB, uint(supplierID), invoiceDate),
+	}
+	vatPayer := activeCompany(c).VatPayer
+
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+
+		for _, line := range source.LineItems {
+			var item models.Item
+			if err := tx.Scopes(inCompany(c), models.Active).Preload("VatRate").First(&item, line.ItemID).Error; err == gorm.ErrRecordNotFound {
+				// Items removed or archived since the original delivery are left out
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			item, err := itemAtDate(tx, item, invoice.Date)
+			if err != nil {
+				return err
+			}
+
+			price, discount := line.Price, line.Discount
+			var mapping models.SupplierItem
+			err = tx.Where("supplier_id = ? AND item_id = ? AND last_date IS NOT NULL", invoice.SupplierID, item.ID).
+				Order("last_date desc").First(&mapping).Error
+			if err == nil {
+				price, discount = mapping.LastPrice, mapping.LastDiscount
+			} else if err != gorm.ErrRecordNotFound {
+				return err
+			}
+
+			invoiceItem := newLineItem(invoice.ID, item, line.Quantity, price, discount, vatPayer)
+			invoiceItem.Note = line.Note
+			invoiceItem.Position = line.Position
+			if err := tx.Create(&invoiceItem).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not duplicate invoice: " + err.Error(),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"invoicing-item-app/csv"
+	"invoicing-item-app/models"
+	"invoicing-item-app/ubl"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImportLineItems reads supplier lines from an uploaded CSV/XLSX file into a draft invoice.
+// Lines with a remembered supplier code are added right away, the rest wait for manual pairing.
+func (ic *InvoiceHandler) ImportLineItems(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+			"error": postedInvoiceError,
+		})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error getting file: %v", err)
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error opening file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error reading file: %v", err)
+		return
+	}
+	lines, err := csv.ReadSupplierLines(data, file.Filename)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error reading file: %v", err)
+		return
+	}
+
+	// The file is imported completely or not at all, importing it again must not duplicate lines
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		for _, line := range lines {
+			importLine := models.ImportLine{
+				SupplierCode: line.Code,
+				Name:         line.Name,
+				Quantity:     line.Quantity,
+				Price:        line.Price,
+				Discount:     line.Discount,
+			}
+			if err := addImportLine(tx, invoice, importLine, activeCompany(c).VatPayer); err != nil {
+				return fmt.Errorf("line %q: %v", line.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not import line: " + err.Error(),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
+}
+
+// ImportEInvoice creates a draft invoice from an uploaded SEF e-invoice (UBL 2.1 XML).
+// The seller is matched by PIB and created when unknown.
+func (ic *InvoiceHandler) ImportEInvoice(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error getting file: %v", err)
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error opening file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	document, err := ubl.Parse(f)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error reading e-invoice: %v", err)
+		return
+	}
+
+	invoiceDate, err := document.Date()
+	if err != nil {
+		invoiceDate = time.Now()
+	}
+
+	var invoice models.Invoice
+	var duplicate models.Invoice
+	var isDuplicate bool
+	company := activeCompany(c)
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		supplier, err := findOrCreateSupplier(tx, company.ID, document.Supplier)
+		if err != nil {
+			return err
+		}
+
+		duplicate, isDuplicate, err = findDuplicateInvoice(tx.Scopes(inCompany(c)), supplier.ID, document.ID, invoiceDate)
+		if err != nil || isDuplicate {
+			return err
+		}
+
+		invoice = models.Invoice{
+			CompanyID:      company.ID,
+			SupplierID:     supplier.ID,
+			LocationID:     activeLocationID(ic.DB, c),
+			DocumentNumber: document.ID,
+			Date:           invoiceDate,
+			DueDate:        models.DefaultDueDate(tx, supplier.ID, invoiceDate),
+		}
+		if dueDate, err := time.Parse("2006-01-02", strings.TrimSpace(document.DueDate)); err == nil {
+			invoice.DueDate = &dueDate
+		}
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+
+		// A line that cannot be stored discards the whole invoice, a half imported one would go unnoticed
+		for _, line := range document.Lines {
+			importLine := models.ImportLine{
+				SupplierCode: line.SellersCode,
+				Name:         line.Name,
+				Quantity:     line.Quantity,
+				Price:        line.UnitPrice(),
+				Discount:     line.Discount(),
+				TaxCategory:  line.TaxCategory,
+				TaxRate:      line.TaxPercent,
+			}
+			if err := addImportLine(tx, invoice, importLine, company.VatPayer); err != nil {
+				return fmt.Errorf("line %q: %v", line.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not import invoice: " + err.Error(),
+		})
+		return
+	}
+	if isDuplicate {
+		duplicateInvoiceError(c, duplicate)
+		return
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
+}
+
+// findOrCreateSupplier looks up the seller among the suppliers of the company by PIB
+func findOrCreateSupplier(db *gorm.DB, companyID uint, party ubl.Party) (models.Supplier, error) {
+	var supplier models.Supplier
+	pib := party.PIB()
+	if pib == "" {
+		return supplier, fmt.Errorf("seller has no PIB")
+	}
+
+	err := db.Where("company_id = ? AND pib = ?", companyID, pib).First(&supplier).Error
+	if err == gorm.ErrRecordNotFound {
+		supplier = models.Supplier{
+			CompanyID:          companyID,
+			Name:               party.DisplayName(),
+			PIB:                pib,
+			RegistrationNumber: strings.TrimSpace(party.LegalID),
+			Address:            strings.TrimSpace(party.Street),
+			PostalCode:         strings.TrimSpace(party.PostalZone),
+			City:               strings.TrimSpace(party.City),
+		}
+		if errors := supplier.Validate(); len(errors) > 0 {
+			return supplier, fmt.Errorf("seller %s: %s", supplier.Name, joinErrors(errors))
+		}
+		err = db.Create(&supplier).Error
+	}
+	return supplier, err
+}
+
+// joinErrors lists validation errors in a stable order
+func joinErrors(errors map[string]string) string {
+	messages := make([]string, 0, len(errors))
+	for _, message := range errors {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
+
+// addImportLine adds a supplier line to the invoice when its article is already mapped
+// to one of our items, otherwise it keeps the line for manual pairing. A mapped line
+// whose VAT rate differs from the item's is kept for pairing as well, with a warning.
+func addImportLine(db *gorm.DB, invoice models.Invoice, line models.ImportLine, vatPayer bool) error {
+	mapping, err := findSupplierItem(db, invoice.SupplierID, line.SupplierCode, line.Name)
+	if err == nil && mapping.Item.ID != 0 {
+		item, err := itemAtDate(db, mapping.Item, invoice.Date)
+		if err != nil {
+			return err
+		}
+		if line.Warning = line.VatWarning(item); line.Warning == "" {
+			invoiceItem := newLineItem(invoice.ID, item, line.Quantity, line.Price, line.Discount, vatPayer)
+			if err := db.Create(&invoiceItem).Error; err != nil {
+				return err
+			}
+			return rememberSupplierItem(db, invoice, line.SupplierCode, line.Name, item, line.Price, line.Discount)
+		}
+	} else if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	line.InvoiceID = invoice.ID
+	return db.Create(&line).Error
+}
+
+// PairImportLine adds an unmatched import line to the invoice as the selected item
+// and remembers the supplier code for future imports.
+func (ic *InvoiceHandler) PairImportLine(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+			"error": postedInvoiceError,
+		})
+		return
+	}
+
+	var importLine models.ImportLine
+	if err := ic.DB.Where("invoice_id = ?", invoice.ID).First(&importLine, paramID(c, "line_id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Import line not found",
+		})
+		return
+	}
+
+	itemID, err := strconv.Atoi(c.PostForm("item_id"))
+	if err != nil || itemID == 0 {
+		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
+			"error": "Please select an item",
+		})
+		return
+	}
+
+	var item models.Item
+	if err := ic.DB.Scopes(inCompany(c)).Preload("VatRate").First(&item, itemID).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Item not found",
+		})
+		return
+	}
+
+	item, err = itemAtDate(ic.DB, item, invoice.Date)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load item price: " + err.Error(),
+		})
+		return
+	}
+
+	// A different VAT rate usually means the wrong item, it is paired only once accepted
+	if warning := importLine.VatWarning(item); warning != "" && c.PostForm("accept_vat") == "" {
+		if err := ic.DB.Model(&importLine).Update("warning", warning).Error; err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not pair line: " + err.Error(),
+			})
+			return
+		}
+		c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
+		return
+	}
+
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		invoiceItem := newLineItem(invoice.ID, item, importLine.Quantity, importLine.Price, importLine.Discount, activeCompany(c).VatPayer)
+		invoiceItem.Position = importLine.Position
+		if err := tx.Create(&invoiceItem).Error; err != nil {
+			return err
+		}
+		if err := rememberSupplierItem(tx, invoice, importLine.SupplierCode, importLine.Name, item, importLine.Price, importLine.Discount); err != nil {
+			return err
+		}
+		return tx.Delete(&importLine).Error
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not pair line: " + err.Error(),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
+}
+
+// RemoveImportLine discards an unmatched import line
+func (ic *InvoiceHandler) RemoveImportLine(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": postedInvoiceError,
+		})
+		return
+	}
+
+	if err := ic.DB.Where("invoice_id = ?", invoice.ID).Delete(&models.ImportLine{}, paramID(c, "line_id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Could not remove line",
+		})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// findSupplierItem looks up the remembered mapping by supplier article code,
+// falling back to the supplier's article name when the line has no code.
+func findSupplierItem(db *gorm.DB, supplierID uint, code, name string) (models.SupplierItem, error) {
+	var mapping models.SupplierItem
+	query := db.Preload("Item.VatRate").Where("supplier_id = ?", supplierID)
+	if code != "" {
+		query = query.Where("supplier_code = ?", code)
+	} else {
+		query = query.Where("supplier_code = '' AND LOWER(supplier_name) = ?", strings.ToLower(name))
+	}
+	err := query.First(&mapping).Error
+	return mapping, err
+}
+
+// rememberSupplierItem keeps the supplier article mapping and its last purchase terms up to date.
+// Lines entered by hand carry no supplier code or name, so they update the mapping of the item.
+func rememberSupplierItem(db *gorm.DB, invoice models.Invoice, code, name string, item models.Item, price, discount float64) error {
+	var mapping models.SupplierItem
+	var err error
+	if code != "" || name != "" {
+		mapping, err = findSupplierItem(db, invoice.SupplierID, code, name)
+	} else {
+		err = db.Where("supplier_id = ? AND item_id = ?", invoice.SupplierID, item.ID).Order("updated_at desc").First(&mapping).Error
+		name = item.Name
+	}
+	if err == gorm.ErrRecordNotFound {
+		mapping = models.SupplierItem{
+			SupplierID:   invoice.SupplierID,
+			SupplierCode: code,
+			SupplierName: name,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	mapping.ItemID = item.ID
+	// Entering an older document must not overwrite newer purchase terms
+	if mapping.LastDate == nil || !invoice.Date.Before(*mapping.LastDate) {
+		date := invoice.Date
+		mapping.LastPrice = price
+		mapping.LastDiscount = discount
+		mapping.LastDate = &date
+	}
+	return db.Omit("Item").Save(&mapping).Error
+}
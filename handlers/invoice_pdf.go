@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"invoicing-item-app/csv"
+	"invoicing-item-app/models"
+	"invoicing-item-app/pdf"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page layout of the kalkulacija, A4 landscape in points
+const (
+	pageWidth    = pdf.A4Height
+	pageHeight   = pdf.A4Width
+	pageMargin   = 28.0
+	tableFont    = 7.0
+	headerFont   = 6.5
+	rowPadding   = 3.0
+	lineHeight   = 9.0
+	footerHeight = 60.0
+)
+
+// kalkulacijaColumn is one column of the kalkulacija table
+type kalkulacijaColumn struct {
+	Number int
+	Title  string
+	Group  string
+	Width  float64
+	Align  string
+	Value  func(item models.InvoiceItem) string
+	Total  func(invoice models.Invoice) string
+}
+
+func amount(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+// kalkulacijaColumns returns the table columns, businesses outside the VAT system have no VAT columns.
+// The name column takes the width the other columns leave between the margins.
+func kalkulacijaColumns(vatPayer bool) []kalkulacijaColumn {
+	sellingTitle := "Prodajna vrednost robe bez PDV (6 + 7 + 8)"
+	totalTitle := "Prodajna vrednost robe sa obračunatim PDV (9 + 11)"
+	if !vatPayer {
+		sellingTitle = "Prodajna vrednost robe (6 + 7 + 8)"
+		totalTitle = "Prodajna vrednost robe (9)"
+	}
+
+	columns := []kalkulacijaColumn{
+		{Number: 1, Title: "Red. broj", Width: 24, Align: "center"},
+		{Number: 2, Title: "Naziv robe", Align: "left",
+			Value: func(i models.InvoiceItem) string { return i.Name }},
+		{Number: 3, Title: "Jedinica mere", Width: 32, Align: "center",
+			Value: func(i models.InvoiceItem) string { return i.Unit }},
+		{Number: 4, Title: "Količina", Group: "Po fakturi dobavljača", Width: 48, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.Quantity) }},
+		{Number: 5, Title: "Cena po jedinici mere", Group: "Po fakturi dobavljača", Width: 56, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.BuyingPrice) }},
+		{Number: 6, Title: "Vrednost robe (4 x 5)", Group: "Po fakturi dobavljača", Width: 62, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.Subtotal) },
+			Total: func(inv models.Invoice) string { return amount(inv.Subtotal) }},
+		{Number: 7, Title: "Zavisni troškovi", Width: 46, Align: "right"},
+		{Number: 8, Title: "Razlika u ceni", Width: 56, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.Margin()) },
+			Total: func(inv models.Invoice) string { return amount(inv.Margin()) }},
+		{Number: 9, Title: sellingTitle, Width: 62, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.SellingValue()) },
+			Total: func(inv models.Invoice) string { return amount(inv.SellingValue()) }},
+	}
+	if vatPayer {
+		columns = append(columns,
+			kalkulacijaColumn{Number: 10, Title: "Stopa", Group: "PDV", Width: 40, Align: "center",
+				Value: func(i models.InvoiceItem) string { return fmt.Sprintf("%s %.2f%%", i.TaxLabel, i.TaxRate) }},
+			kalkulacijaColumn{Number: 11, Title: "Obračunati iznos", Group: "PDV", Width: 56, Align: "right",
+				Value: func(i models.InvoiceItem) string { return amount(i.TaxAmount) },
+				Total: func(inv models.Invoice) string { return amount(inv.TaxAmount) }},
+		)
+	}
+	columns = append(columns,
+		kalkulacijaColumn{Number: 12, Title: totalTitle, Width: 64, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.Total) },
+			Total: func(inv models.Invoice) string { return amount(inv.Total) }},
+		kalkulacijaColumn{Number: 13, Title: "Prodajna cena po jedinici mere (12 : 4)", Width: 56, Align: "right",
+			Value: func(i models.InvoiceItem) string { return amount(i.SellingPrice) }},
+		kalkulacijaColumn{Number: 14, Title: "Napomena", Width: 34, Align: "left",
+			Value: func(i models.InvoiceItem) string { return i.Note }},
+	)
+
+	nameWidth := pageWidth - 2*pageMargin
+	for _, column := range columns {
+		nameWidth -= column.Width
+	}
+	columns[1].Width = nameWidth
+	return columns
+}
+
+// cellText writes s into a table cell using the column alignment
+func cellText(page *pdf.Page, x, y, width float64, align string, bold bool, s string) {
+	s = pdf.Fit(s, width-2*rowPadding, tableFont, bold)
+	switch align {
+	case "right":
+		page.TextRight(x+width-rowPadding, y, tableFont, bold, s)
+	case "center":
+		page.TextCenter(x+width/2, y, tableFont, bold, s)
+	default:
+		page.Text(x+rowPadding, y, tableFont, bold, s)
+	}
+}
+
+// drawTableHeader draws the column titles and numbers and returns the y position below them
+func drawTableHeader(page *pdf.Page, columns []kalkulacijaColumn, y float64) float64 {
+	const groupHeight = 12.0
+	const titleHeight = 42.0
+	const numberHeight = 10.0
+
+	page.FillRect(pageMargin, y, pageWidth-2*pageMargin, groupHeight+titleHeight+numberHeight, 0.92)
+
+	x := pageMargin
+	for i := 0; i < len(columns); i++ {
+		column := columns[i]
+		top, height := y, groupHeight+titleHeight
+		if column.Group != "" {
+			// Columns sharing a group get a common caption above their titles
+			groupWidth := 0.0
+			for j := i; j < len(columns) && columns[j].Group == column.Group; j++ {
+				groupWidth += columns[j].Width
+			}
+			page.Rect(x, y, groupWidth, groupHeight, 0.5)
+			page.TextCenter(x+groupWidth/2, y+8.5, headerFont, true, column.Group)
+			for ; i < len(columns) && columns[i].Group == column.Group; i++ {
+				drawHeaderCell(page, x, y+groupHeight, titleHeight, columns[i])
+				x += columns[i].Width
+			}
+			i--
+			continue
+		}
+		drawHeaderCell(page, x, top, height, column)
+		x += column.Width
+	}
+
+	y += groupHeight + titleHeight
+	x = pageMargin
+	for _, column := range columns {
+		page.Rect(x, y, column.Width, numberHeight, 0.5)
+		page.TextCenter(x+column.Width/2, y+7, headerFont, false, fmt.Sprint(column.Number))
+		x += column.Width
+	}
+	return y + numberHeight
+}
+
+func drawHeaderCell(page *pdf.Page, x, y, height float64, column kalkulacijaColumn) {
+	page.Rect(x, y, column.Width, height, 0.5)
+	lines := pdf.Wrap(column.Title, column.Width-4, headerFont, true)
+	top := y + (height-float64(len(lines))*8)/2 + 6
+	for i, line := range lines {
+		page.TextCenter(x+column.Width/2, top+float64(i)*8, headerFont, true, line)
+	}
+}
+
+// labeledText writes a bold label followed by its value
+func labeledText(page *pdf.Page, x, y, size float64, label, value string) {
+	page.Text(x, y, size, true, label)
+	page.Text(x+pdf.TextWidth(label, size, true)+3, y, size, false, value)
+}
+
+// renderKalkulacija adds the pages of one kalkulacija to the document
+func renderKalkulacija(doc *pdf.Document, company models.Company, images documentImages, invoice models.Invoice, printDate string) {
+	firstPage := len(doc.Pages())
+	columns := kalkulacijaColumns(company.VatPayer)
+	bottom := pageHeight - pageMargin - 14
+	documentLabel := fmt.Sprintf("faktura br. %s od %s godine", invoice.DocumentNumber, invoice.Date.Format("02.01.2006"))
+
+	// Company header and title, the logo takes a corner of the header
+	page := doc.AddPage()
+	y := pageMargin + 10
+	fieldsX := pageMargin
+	if logo, ok := images[models.ImageLogo]; ok {
+		width := logo.ScaledWidth(logo.Height)
+		if logo.Position == models.PositionRight {
+			page.Image(logo.Image, pageWidth-pageMargin-width, pageMargin, logo.Height)
+		} else {
+			page.Image(logo.Image, pageMargin, pageMargin, logo.Height)
+			fieldsX += width + 8
+		}
+	}
+	fields := [][2]string{
+		{"PIB:", company.Code},
+		{"Firma - radnja:", company.Name},
+		{"Obveznik:", company.Owner},
+		{"Sedište:", company.Address},
+		{"Šifra poreskog obveznika:", company.Sector},
+		{"Šifra delatnosti:", company.SectorCode},
+	}
+	if invoice.Location != nil {
+		fields = append(fields, [2]string{"Prodajni objekat:", strings.TrimSpace(invoice.Location.Name + " " + invoice.Location.Address)})
+	}
+	for _, field := range fields {
+		labeledText(page, fieldsX, y, 8, field[0], field[1])
+		y += 11
+	}
+	if logo, ok := images[models.ImageLogo]; ok && logo.Position != models.PositionRight {
+		y = math.Max(y, pageMargin+logo.Height+6)
+	}
+
+	center := pageMargin + (pageWidth-2*pageMargin)*0.75
+	page.TextCenter(center, pageMargin+14, 13, true, "KALKULACIJA PRODAJNE CENE")
+	lineY := pageMargin + 34
+	if invoice.InternalNumber != "" {
+		page.TextCenter(center, pageMargin+28, 10, true, "br. "+invoice.InternalNumber)
+		lineY += 8
+	}
+	supplier := fmt.Sprintf("isporučilac dobra: %s %s %s", invoice.Supplier.Name, invoice.Supplier.PIB, invoice.Supplier.FullAddress())
+	for _, line := range pdf.Wrap(supplier, 380, 8, false) {
+		page.TextCenter(center, lineY, 8, false, line)
+		lineY += 10
+	}
+	page.TextCenter(center, lineY+4, 8, false, "po dokumentu "+documentLabel)
+
+	y = drawTableHeader(page, columns, y+6)
+
+	// Line items, the table header is repeated on every new page
+	for index, item := range invoice.LineItems {
+		nameWidth := columns[1].Width - 2*rowPadding
+		nameLines := pdf.Wrap(item.Name, nameWidth, tableFont, false)
+		if len(nameLines) == 0 {
+			nameLines = []string{""}
+		}
+		height := float64(len(nameLines))*lineHeight + rowPadding
+
+		if y+height > bottom {
+			page = doc.AddPage()
+			title := "Kalkulacija prodajne cene"
+			if invoice.InternalNumber != "" {
+				title += " br. " + invoice.InternalNumber
+			}
+			page.Text(pageMargin, pageMargin+8, 8, true, title+" - "+documentLabel+" (nastavak)")
+			y = drawTableHeader(page, columns, pageMargin+16)
+		}
+
+		x := pageMargin
+		for _, column := range columns {
+			page.Rect(x, y, column.Width, height, 0.5)
+			switch {
+			case column.Number == 1:
+				cellText(page, x, y+lineHeight, column.Width, column.Align, false, fmt.Sprint(index+1))
+			case column.Number == 2:
+				for i, line := range nameLines {
+					cellText(page, x, y+lineHeight+float64(i)*lineHeight, column.Width, column.Align, false, line)
+				}
+			case column.Value != nil:
+				cellText(page, x, y+lineHeight, column.Width, column.Align, false, column.Value(item))
+			}
+			x += column.Width
+		}
+		y += height
+	}
+
+	// Totals
+	if y+lineHeight+rowPadding > bottom {
+		page = doc.AddPage()
+		y = drawTableHeader(page, columns, pageMargin+16)
+	}
+	x := pageMargin
+	for _, column := range columns {
+		page.Rect(x, y, column.Width, lineHeight+rowPadding, 0.5)
+		if column.Number == 2 {
+			cellText(page, x, y+lineHeight, column.Width, column.Align, true, "Ukupno")
+		} else if column.Total != nil {
+			cellText(page, x, y+lineHeight, column.Width, column.Align, true, column.Total(invoice))
+		}
+		x += column.Width
+	}
+	y += lineHeight + rowPadding + 16
+
+	page, y = renderRecapitulation(doc, page, company, invoice, y, bottom)
+
+	// Signatures, a stamp reaches below the signature line
+	footer := footerHeight
+	if stamp, ok := images[models.ImageStamp]; ok {
+		footer = math.Max(footer, 50+stamp.Height/2)
+	}
+	if y+footer > bottom {
+		page = doc.AddPage()
+		y = pageMargin + 16
+	}
+	y += 12
+	labeledText(page, pageMargin, y, 8, "Datum:", printDate+" godine")
+	labeledText(page, pageMargin, y+14, 8, "Sastavio:", company.User)
+	page.Line(pageMargin+45, y+38, pageMargin+205, y+38, 0.5)
+
+	right := pageWidth - pageMargin
+	page.TextRight(right, y, 8, false, company.Owner)
+	page.TextRight(right-pdf.TextWidth(company.Owner, 8, false)-3, y, 8, true, "Odgovorno lice:")
+	page.TextCenter(right-80, y+38-10, 7, false, "M.P.")
+	page.Line(right-160, y+38, right, y+38, 0.5)
+
+	sides := map[string]float64{models.PositionLeft: pageMargin + 125, models.PositionRight: right - 80}
+	drawStampAndSignature(page, images, y+38, sides[images[models.ImageStamp].Position], sides[images[models.ImageSignature].Position])
+
+	// Page numbers within this kalkulacija
+	pages := doc.Pages()[firstPage:]
+	for i, p := range pages {
+		p.TextRight(pageWidth-pageMargin, pageHeight-pageMargin+4, 7, false, fmt.Sprintf("Strana %d/%d", i+1, len(pages)))
+	}
+}
+
+// renderRecapitulation draws the per VAT rate summary below the table
+func renderRecapitulation(doc *pdf.Document, page *pdf.Page, company models.Company, invoice models.Invoice, y, bottom float64) (*pdf.Page, float64) {
+	recap := invoice.Recapitulation()
+	titles := []string{"Stopa", "Nabavna vrednost", "Razlika u ceni"}
+	if company.VatPayer {
+		titles = append(titles, "Osnovica", "PDV")
+	}
+	titles = append(titles, "Prodajna vrednost")
+
+	height := 12 + float64(len(recap)+1)*(lineHeight+rowPadding)
+	if y+height > bottom {
+		page = doc.AddPage()
+		y = pageMargin + 16
+	}
+
+	const width = 70.0
+	page.Text(pageMargin, y, 8, true, "Rekapitulacija po poreskim stopama")
+	y += 4
+	page.FillRect(pageMargin, y, width*float64(len(titles)), lineHeight+rowPadding, 0.92)
+	for i, title := range titles {
+		x := pageMargin + float64(i)*width
+		page.Rect(x, y, width, lineHeight+rowPadding, 0.5)
+		cellText(page, x, y+lineHeight, width, "center", true, title)
+	}
+	y += lineHeight + rowPadding
+
+	for _, r := range recap {
+		values := []string{fmt.Sprintf("%s %.2f%%", r.TaxLabel, r.TaxRate), amount(r.PurchaseValue), amount(r.Margin)}
+		if company.VatPayer {
+			values = append(values, amount(r.Base), amount(r.TaxAmount))
+		}
+		values = append(values, amount(r.Total))
+
+		for i, value := range values {
+			x := pageMargin + float64(i)*width
+			align := "right"
+			if i == 0 {
+				align = "center"
+			}
+			page.Rect(x, y, width, lineHeight+rowPadding, 0.5)
+			cellText(page, x, y+lineHeight, width, align, false, value)
+		}
+		y += lineHeight + rowPadding
+	}
+	return page, y
+}
+
+// GetInvoicePDF renders the kalkulacija as a PDF document for printing or archiving
+func (ic *InvoiceHandler) GetInvoicePDF(c *gin.Context) {
+	company := activeCompany(c)
+
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).Preload("Supplier").Preload("Location").Preload("LineItems", models.OrderedLines).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+
+	invoice.ApplySnapshot(&company)
+
+	doc := pdf.New(pageWidth, pageHeight)
+	doc.Title = "Kalkulacija " + invoice.DocumentNumber
+	// A posted kalkulacija is printed with the images it was posted with
+	images, err := newImageLoader(ic.DB).embed(doc, invoice)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load company images: " + err.Error(),
+		})
+		return
+	}
+	renderKalkulacija(doc, company, images, invoice, time.Now().Format("02.01.2006"))
+
+	data, err := doc.Bytes()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not create PDF: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=kalkulacija-%d.pdf", invoice.ID))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// ExportInvoices exports all completed kalkulacije dated within a period, either as one PDF
+// with every document starting on its own page, or as a ZIP of PDFs with a CSV summary.
+// When a location is active only its kalkulacije are exported.
+func (ic *InvoiceHandler) ExportInvoices(c *gin.Context) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid start date")
+		return
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil || to.Before(from) {
+		c.String(http.StatusBadRequest, "Invalid end date")
+		return
+	}
+
+	company := activeCompany(c)
+
+	var invoices []models.Invoice
+	err = ic.DB.Scopes(inCompany(c), scopeLocation(ic.DB, c)).Preload("Supplier").Preload("Location").Preload("LineItems", models.OrderedLines).
+		Where("completed_at IS NOT NULL AND date >= ? AND date < ?", from, to.AddDate(0, 0, 1)).
+		Order("date, id").Find(&invoices).Error
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load invoices: " + err.Error(),
+		})
+		return
+	}
+	if len(invoices) == 0 {
+		c.String(http.StatusNotFound, "No completed invoices in the selected period")
+		return
+	}
+
+	// Each kalkulacija is printed with the header it was posted with
+	companies := make([]models.Company, len(invoices))
+	for i := range invoices {
+		companies[i] = company
+		invoices[i].ApplySnapshot(&companies[i])
+	}
+
+	// Every PDF embeds its own copy of the images its kalkulacije were posted with
+	images := newImageLoader(ic.DB)
+
+	printDate := time.Now().Format("02.01.2006")
+	period := fmt.Sprintf("%s_%s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+
+	if c.Query("format") == "zip" {
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		for i, invoice := range invoices {
+			doc := pdf.New(pageWidth, pageHeight)
+			doc.Title = "Kalkulacija " + invoice.DocumentNumber
+			invoiceImages, err := images.embed(doc, invoice)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error adding images: %v", err)
+				return
+			}
+			renderKalkulacija(doc, companies[i], invoiceImages, invoice, printDate)
+			numberDocument(doc, 0, i+1, len(invoices))
+
+			w, err := archive.Create(csv.InvoicePDFName(i+1, invoice))
+			if err == nil {
+				_, err = doc.WriteTo(w)
+			}
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error creating archive: %v", err)
+				return
+			}
+		}
+
+		summary, err := csv.ExportInvoiceSummaryToCSV(invoices)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error exporting summary: %v", err)
+			return
+		}
+		w, err := archive.Create("kalkulacije.csv")
+		if err == nil {
+			_, err = w.Write(summary)
+		}
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error creating archive: %v", err)
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=kalkulacije_%s.zip", period))
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+		return
+	}
+
+	doc := pdf.New(pageWidth, pageHeight)
+	doc.Title = "Kalkulacije " + period
+	for i, invoice := range invoices {
+		invoiceImages, err := images.embed(doc, invoice)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not add company images: " + err.Error(),
+			})
+			return
+		}
+		first := len(doc.Pages())
+		renderKalkulacija(doc, companies[i], invoiceImages, invoice, printDate)
+		numberDocument(doc, first, i+1, len(invoices))
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not create PDF: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=kalkulacije_%s.pdf", period))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// numberDocument marks the pages of one kalkulacija with its position in the export
+func numberDocument(doc *pdf.Document, firstPage, number, count int) {
+	for _, page := range doc.Pages()[firstPage:] {
+		page.Text(pageMargin, pageHeight-pageMargin+4, 7, false, fmt.Sprintf("Dokument %d/%d", number, count))
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"invoicing-item-app/models"
@@ -20,30 +23,48 @@ func NewInvoiceHandler(db *gorm.DB) *InvoiceHandler {
 	return &InvoiceHandler{DB: db}
 }
 
+// Answer to changes of the lines of a posted kalkulacija, they are already in the book
+const postedInvoiceError = "Invoice is posted, its lines can no longer be changed"
+
 func (ic *InvoiceHandler) GetInvoices(c *gin.Context) {
 	var invoices []models.Invoice
-	if err := ic.DB.Preload("Supplier").Preload("LineItems").Find(&invoices).Error; err != nil {
+	err := ic.DB.Scopes(inCompany(c), scopeLocation(ic.DB, c)).Preload("Supplier").Preload("Location").Preload("LineItems", models.OrderedLines).
+		Find(&invoices).Error
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load invoices: " + err.Error(),
+		})
+		return
+	}
+
+	// A supplier document may have been entered again under another location
+	var all []models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).Select("id", "supplier_id", "document_number", "date").Order("id").Find(&all).Error; err != nil {
 		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
 			"error": "Failed to load invoices: " + err.Error(),
 		})
 		return
 	}
+	markDuplicates(invoices, all)
 
 	// Get suppliers for the invoice creation form
 	var suppliers []models.Supplier
-	if err := ic.DB.Find(&suppliers).Error; err != nil {
+	if err := ic.DB.Scopes(inCompany(c), models.Active).Find(&suppliers).Error; err != nil {
 		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
 			"error": "Failed to load suppliers: " + err.Error(),
 		})
 		return
 	}
 
+	now := time.Now()
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"invoices":  invoices,
-		"suppliers": suppliers,
-		"TodayDate": time.Now().Format("2006-01-02"),
-		"active":    "invoices",
-		"Title":     "Invoices",
+		"invoices":   invoices,
+		"suppliers":  suppliers,
+		"TodayDate":  now.Format("2006-01-02"),
+		"MonthStart": time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02"),
+		"location":   activeLocation(ic.DB, c),
+		"active":     "invoices",
+		"Title":      "Invoices",
 	})
 }
 
@@ -56,6 +77,13 @@ func (ic *InvoiceHandler) InitializeInvoice(c *gin.Context) {
 		return
 	}
 
+	if !inActiveCompany(ic.DB, c, &models.Supplier{}, supplierID) {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Supplier not found",
+		})
+		return
+	}
+
 	documentNumber := c.PostForm("document_number")
 	if documentNumber == "" {
 		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
@@ -77,11 +105,24 @@ func (ic *InvoiceHandler) InitializeInvoice(c *gin.Context) {
 		invoiceDate = time.Now()
 	}
 
+	if existing, found, err := findDuplicateInvoice(ic.DB.Scopes(inCompany(c)), uint(supplierID), documentNumber, invoiceDate); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not check document number: " + err.Error(),
+		})
+		return
+	} else if found {
+		duplicateInvoiceError(c, existing)
+		return
+	}
+
 	// Create a new invoice with basic info
 	invoice := models.Invoice{
+		CompanyID:      activeCompany(c).ID,
 		SupplierID:     uint(supplierID),
+		LocationID:     activeLocationID(ic.DB, c),
 		DocumentNumber: documentNumber,
 		Date:           invoiceDate,
+		DueDate:        models.DefaultDueDate(ic.DB, uint(supplierID), invoiceDate),
 		Subtotal:       0,
 		TaxAmount:      0,
 		Total:          0,
@@ -98,6 +139,46 @@ func (ic *InvoiceHandler) InitializeInvoice(c *gin.Context) {
 	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/edit", invoice.ID))
 }
 
+// findDuplicateInvoice looks for an invoice already entered for the same supplier document in the same year.
+// The given query is expected to be limited to the company of the new invoice.
+func findDuplicateInvoice(db *gorm.DB, supplierID uint, documentNumber string, date time.Time) (models.Invoice, bool, error) {
+	var invoice models.Invoice
+	yearStart := time.Date(date.Year(), 1, 1, 0, 0, 0, 0, date.Location())
+	err := db.Where("supplier_id = ? AND LOWER(TRIM(document_number)) = ? AND date >= ? AND date < ?",
+		supplierID, strings.ToLower(strings.TrimSpace(documentNumber)), yearStart, yearStart.AddDate(1, 0, 0)).
+		First(&invoice).Error
+	if err == gorm.ErrRecordNotFound {
+		return invoice, false, nil
+	}
+	return invoice, err == nil, err
+}
+
+func duplicateInvoiceError(c *gin.Context, existing models.Invoice) {
+	c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+		"error":    fmt.Sprintf("Document %s of this supplier was already entered on %s.", existing.DocumentNumber, existing.Date.Format("02.01.2006")),
+		"link":     fmt.Sprintf("/invoices/%d/view", existing.ID),
+		"linkText": "Open existing invoice",
+	})
+}
+
+// markDuplicates points every listed invoice sharing a supplier document with another invoice of
+// the company to the first such invoice
+func markDuplicates(invoices, all []models.Invoice) {
+	byKey := make(map[string][]uint)
+	for _, invoice := range all {
+		key := invoice.DuplicateKey()
+		byKey[key] = append(byKey[key], invoice.ID)
+	}
+	for i := range invoices {
+		for _, id := range byKey[invoices[i].DuplicateKey()] {
+			if id != invoices[i].ID {
+				invoices[i].DuplicateOf = id
+				break
+			}
+		}
+	}
+}
+
 // GetInvoiceEditPage loads the invoice edit page
 func (ic *InvoiceHandler) GetInvoiceEditPage(c *gin.Context) {
 	invoiceID := c.Param("id")
@@ -110,7 +191,7 @@ func (ic *InvoiceHandler) GetInvoiceEditPage(c *gin.Context) {
 	}
 
 	var invoice models.Invoice
-	if err := ic.DB.Preload("Supplier").Preload("LineItems").First(&invoice, id).Error; err != nil {
+	if err := ic.DB.Scopes(inCompany(c)).Preload("Supplier").Preload("LineItems", models.OrderedLines).First(&invoice, id).Error; err != nil {
 		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
 			"error": "Invoice not found",
 		})
@@ -119,18 +200,42 @@ func (ic *InvoiceHandler) GetInvoiceEditPage(c *gin.Context) {
 
 	// Load all available items
 	var items []models.Item
-	if err := ic.DB.Find(&items).Error; err != nil {
+	if err := ic.DB.Preload("VatRate").Scopes(inCompany(c), models.Active).Find(&items).Error; err != nil {
 		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
 			"error": "Could not load items: " + err.Error(),
 		})
 		return
 	}
 
+	// Last purchase terms from this supplier are offered as hints when an item is picked
+	var supplierItems []models.SupplierItem
+	if err := ic.DB.Where("supplier_id = ?", invoice.SupplierID).Order("last_date").Find(&supplierItems).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load supplier prices: " + err.Error(),
+		})
+		return
+	}
+	lastPrices := make(map[uint]models.SupplierItem)
+	for _, supplierItem := range supplierItems {
+		lastPrices[supplierItem.ItemID] = supplierItem
+	}
+
+	// Load imported lines still waiting to be paired with an item
+	var importLines []models.ImportLine
+	if err := ic.DB.Where("invoice_id = ?", invoice.ID).Find(&importLines).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load imported lines: " + err.Error(),
+		})
+		return
+	}
+
 	c.HTML(http.StatusOK, "invoice-form.html", gin.H{
-		"Invoice": invoice,
-		"Items":   items,
-		"active":  "invoices",
-		"Title":   "Edit Invoice",
+		"Invoice":     invoice,
+		"Items":       items,
+		"ImportLines": importLines,
+		"LastPrices":  lastPrices,
+		"active":      "invoices",
+		"Title":       "Edit Invoice",
 	})
 }
 
@@ -153,10 +258,16 @@ func (ic *InvoiceHandler) AddLineItem(c *gin.Context) {
 		return
 	}
 
-	var existingItem models.InvoiceItem
-	if err := ic.DB.Where("invoice_id = ? AND item_id = ?", invoiceIDInt, itemID).First(&existingItem).Error; err == nil {
-		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
-			"error": "Item already added to invoice",
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, invoiceIDInt).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+			"error": postedInvoiceError,
 		})
 		return
 	}
@@ -169,8 +280,9 @@ func (ic *InvoiceHandler) AddLineItem(c *gin.Context) {
 		return
 	}
 
+	// A negative quantity is goods returned to the supplier, the line lowers the invoice total
 	quantity, err := strconv.ParseFloat(c.PostForm("quantity"), 64)
-	if err != nil || quantity <= 0 {
+	if err != nil || quantity == 0 {
 		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
 			"error": "Please enter a valid quantity",
 		})
@@ -183,31 +295,131 @@ func (ic *InvoiceHandler) AddLineItem(c *gin.Context) {
 	}
 
 	var item models.Item
-	if err := ic.DB.First(&item, itemID).Error; err != nil {
+	if err := ic.DB.Scopes(inCompany(c)).Preload("VatRate").First(&item, itemID).Error; err != nil {
 		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
 			"error": "Item not found",
 		})
 		return
 	}
+	if item.Archived {
+		c.HTML(http.StatusBadRequest, "error.tmpl", gin.H{
+			"error": "Item " + item.Name + " is archived",
+		})
+		return
+	}
+
+	item, err = itemAtDate(ic.DB, item, invoice.Date)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load item price: " + err.Error(),
+		})
+		return
+	}
 
-	// Calculate values
+	// A selling price entered on the kalkulacija is kept on the line, it becomes the item's price
+	// from the document date once the kalkulacija is posted
+	if sellingPrice, err := strconv.ParseFloat(c.PostForm("selling_price"), 64); err == nil && sellingPrice > 0 {
+		item.Price = sellingPrice
+	}
+
+	// Compare with the supplier's last price before it gets replaced by this one,
+	// a return is priced as it was bought and is neither compared nor remembered
+	company := activeCompany(c)
+	returned := quantity < 0
+	var lastPrice, deviation float64
+	var deviates bool
+	if !returned {
+		lastPrice, deviation, deviates = ic.priceDeviation(company, invoice, item.ID, price, discount)
+	}
+
+	invoiceItem := newLineItem(invoice.ID, item, quantity, price, discount, company.VatPayer)
+
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invoiceItem).Error; err != nil {
+			return err
+		}
+		if returned {
+			return nil
+		}
+		return rememberSupplierItem(tx, invoice, "", "", item, price, discount)
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not add item to invoice: " + err.Error(),
+		})
+		return
+	}
+
+	if deviates {
+		trigger, _ := json.Marshal(gin.H{
+			"priceWarning": gin.H{"lastPrice": lastPrice, "deviation": deviation},
+		})
+		c.Header("HX-Trigger", string(trigger))
+	}
+
+	// Render the line item template
+	c.HTML(http.StatusOK, "invoice-line-item.html", invoiceItem)
+}
+
+// priceDeviation compares the net purchase price with the last one from the invoice's supplier.
+// It reports whether the deviation in percent exceeds the threshold set on the company.
+func (ic *InvoiceHandler) priceDeviation(company models.Company, invoice models.Invoice, itemID uint, price, discount float64) (float64, float64, bool) {
+	if company.PriceDeviationPercent <= 0 {
+		return 0, 0, false
+	}
+
+	var mapping models.SupplierItem
+	if err := ic.DB.Where("supplier_id = ? AND item_id = ? AND last_price > 0", invoice.SupplierID, itemID).Order("last_date desc").First(&mapping).Error; err != nil {
+		return 0, 0, false
+	}
+
+	lastNet := mapping.LastPrice * (1 - mapping.LastDiscount/100)
+	if lastNet <= 0 {
+		return 0, 0, false
+	}
+	net := price * (1 - discount/100)
+	deviation := (net - lastNet) / lastNet * 100
+	return lastNet, deviation, math.Abs(deviation) > company.PriceDeviationPercent
+}
+
+// itemAtDate returns the item with the selling price and VAT rate valid on the given document date
+func itemAtDate(db *gorm.DB, item models.Item, date time.Time) (models.Item, error) {
+	price, err := models.PriceAt(db, item, date)
+	if err != nil {
+		return item, err
+	}
+	item.Price = price
+	item.VatRate, err = models.VatRateAt(db, item.VatRate, date)
+	return item, err
+}
+
+// newLineItem calculates an invoice line for the given item and supplier price.
+// VAT payers deduct the supplier's VAT and split VAT out of the selling value,
+// businesses outside the VAT system carry the supplier's VAT as part of the cost.
+func newLineItem(invoiceID uint, item models.Item, quantity, price, discount float64, vatPayer bool) models.InvoiceItem {
+	taxRate := item.TaxPercent()
 	buyingPrice := price * (1 - discount/100)
-	buyingPriceWithTax := buyingPrice * (1 + float64(item.TaxRate)/100)
-	buyingSubtotal := buyingPriceWithTax * quantity
+	if !vatPayer {
+		buyingPrice *= 1 + taxRate/100
+	}
+	buyingSubtotal := buyingPrice * quantity
 	sellingPrice := item.Price
-	sellingPriceWithTax := sellingPrice
-	sellingTotal := sellingPriceWithTax * quantity
+	sellingTotal := sellingPrice * quantity
 
-	pc := float64(100*item.TaxRate) / float64(100+item.TaxRate) / 100
-	taxAmount := sellingTotal * pc
+	taxAmount := 0.0
+	if vatPayer {
+		taxAmount = sellingTotal * taxRate / (100 + taxRate)
+	}
 
-	// Create the invoice item
-	invoiceItem := models.InvoiceItem{
-		InvoiceID:    uint(invoiceIDInt),
-		ItemID:       uint(itemID),
+	return models.InvoiceItem{
+		InvoiceID:    invoiceID,
+		ItemID:       item.ID,
 		Name:         item.Name,
 		Unit:         item.Unit,
-		TaxRate:      float64(item.TaxRate),
+		VatRateID:    item.VatRate.ID,
+		TaxLabel:     item.VatRate.Label,
+		TaxRate:      taxRate,
+		Price:        price,
 		Discount:     discount,
 		Quantity:     quantity,
 		BuyingPrice:  buyingPrice,
@@ -216,24 +428,28 @@ func (ic *InvoiceHandler) AddLineItem(c *gin.Context) {
 		SellingPrice: sellingPrice,
 		Total:        sellingTotal,
 	}
-
-	if err := ic.DB.Create(&invoiceItem).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
-			"error": "Could not add item to invoice: " + err.Error(),
-		})
-		return
-	}
-
-	// Render the line item template
-	c.HTML(http.StatusOK, "invoice-line-item.html", invoiceItem)
 }
 
 // RemoveLineItem removes an item from an invoice
 func (ic *InvoiceHandler) RemoveLineItem(c *gin.Context) {
-	invoiceID := c.Param("id")
-	itemID := c.Param("item_id")
+	invoiceID := paramID(c, "id")
+	lineID := paramID(c, "line_id")
+
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, invoiceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": postedInvoiceError,
+		})
+		return
+	}
 
-	if err := ic.DB.Where("invoice_id = ? AND item_id = ?", invoiceID, itemID).Delete(&models.InvoiceItem{}).Error; err != nil {
+	if err := ic.DB.Where("invoice_id = ?", invoiceID).Delete(&models.InvoiceItem{}, lineID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Could not remove item",
 		})
@@ -247,6 +463,83 @@ func (ic *InvoiceHandler) RemoveLineItem(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// MoveLineItem swaps a line with the one above or below it and renders the reordered lines
+func (ic *InvoiceHandler) MoveLineItem(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return
+	}
+	if invoice.Posted() {
+		c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+			"error": postedInvoiceError,
+		})
+		return
+	}
+
+	var line models.InvoiceItem
+	if err := ic.DB.Where("invoice_id = ?", invoice.ID).First(&line, paramID(c, "line_id")).Error; err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Line not found",
+		})
+		return
+	}
+
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		var lines []models.InvoiceItem
+		if err := models.OrderedLines(tx.Where("invoice_id = ?", line.InvoiceID)).Find(&lines).Error; err != nil {
+			return err
+		}
+
+		// Lines sharing a position or leaving gaps are numbered 1..n in their current order first
+		index := -1
+		for i := range lines {
+			if lines[i].ID == line.ID {
+				index = i
+			}
+			if lines[i].Position == i+1 {
+				continue
+			}
+			lines[i].Position = i + 1
+			if err := tx.Model(&lines[i]).Update("position", lines[i].Position).Error; err != nil {
+				return err
+			}
+		}
+
+		// The first line cannot move up and the last cannot move down
+		other := index + 1
+		if c.PostForm("direction") == "up" {
+			other = index - 1
+		}
+		if index < 0 || other < 0 || other >= len(lines) {
+			return nil
+		}
+		linePosition, otherPosition := lines[other].Position, lines[index].Position
+		if err := tx.Model(&lines[index]).Update("position", linePosition).Error; err != nil {
+			return err
+		}
+		return tx.Model(&lines[other]).Update("position", otherPosition).Error
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not move line: " + err.Error(),
+		})
+		return
+	}
+
+	var lines []models.InvoiceItem
+	if err := models.OrderedLines(ic.DB.Where("invoice_id = ?", line.InvoiceID)).Find(&lines).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load lines: " + err.Error(),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "invoice-line-items.html", lines)
+}
+
 func (ic *InvoiceHandler) CompleteInvoice(c *gin.Context) {
 	invoiceID := c.Param("id")
 	invoiceIDInt, err := strconv.Atoi(invoiceID)
@@ -258,7 +551,7 @@ func (ic *InvoiceHandler) CompleteInvoice(c *gin.Context) {
 	}
 
 	var invoice models.Invoice
-	if err := ic.DB.Preload("LineItems").First(&invoice, invoiceID).Error; err != nil {
+	if err := ic.DB.Scopes(inCompany(c)).Preload("Location").Preload("LineItems", models.OrderedLines).First(&invoice, invoiceID).Error; err != nil {
 		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
 			"error": "Invoice not found",
 		})
@@ -272,17 +565,75 @@ func (ic *InvoiceHandler) CompleteInvoice(c *gin.Context) {
 		return
 	}
 
+	// Import lines can no longer be paired once the invoice is posted
+	var pending int64
+	if err := ic.DB.Model(&models.ImportLine{}).Where("invoice_id = ?", invoice.ID).Count(&pending).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load import lines: " + err.Error(),
+		})
+		return
+	}
+	if pending > 0 {
+		c.HTML(http.StatusConflict, "error.tmpl", gin.H{
+			"error": fmt.Sprintf("Invoice has %d imported lines that are not paired with items", pending),
+		})
+		return
+	}
+
 	invoice.Subtotal = 0
 	invoice.TaxAmount = 0
 	invoice.Total = 0
 
+	invoice.SupplierTotal = 0
+
 	for _, item := range invoice.LineItems {
 		invoice.Subtotal += item.Subtotal
 		invoice.TaxAmount += item.TaxAmount
 		invoice.Total += item.Total
+		invoice.SupplierTotal += item.SupplierValue()
 	}
+	posting := invoice.CompletedAt == nil
+	if posting {
+		now := time.Now()
+		invoice.CompletedAt = &now
+	}
+
+	numberFormat := models.DefaultNumberFormat
+	company := activeCompany(c)
+	if company.NumberFormat != "" {
+		numberFormat = company.NumberFormat
+	}
+
+	// The printed header must not change when company or supplier data is edited later
+	var supplier models.Supplier
+	if err := ic.DB.First(&supplier, invoice.SupplierID).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load supplier: " + err.Error(),
+		})
+		return
+	}
+	firstPosting := !invoice.HasSnapshot()
+	invoice.TakeSnapshot(company, supplier)
 
-	if err := ic.DB.Save(&invoice).Error; err != nil {
+	// The internal number is taken in the same transaction, so a failed completion leaves no gap
+	err = ic.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.AssignInternalNumber(tx, &invoice, numberFormat); err != nil {
+			return err
+		}
+		if err := tx.Save(&invoice).Error; err != nil {
+			return err
+		}
+		if posting {
+			if err := recordSellingPrices(tx, invoice); err != nil {
+				return err
+			}
+		}
+		if firstPosting {
+			return models.SnapshotImages(tx, invoice.ID, company.ID)
+		}
+		return nil
+	})
+	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
 			"error": "Could not update invoice: " + err.Error(),
 		})
@@ -293,37 +644,103 @@ func (ic *InvoiceHandler) CompleteInvoice(c *gin.Context) {
 	c.Redirect(http.StatusFound, fmt.Sprintf("/invoices/%d/view", invoiceIDInt))
 }
 
+// recordSellingPrices makes the selling prices of a posted kalkulacija the prices of its items
+// from the document date. Lines priced at the item's price of that date change nothing.
+func recordSellingPrices(db *gorm.DB, invoice models.Invoice) error {
+	for _, line := range invoice.LineItems {
+		// Returned goods are not sold again at the line's price
+		if line.Quantity < 0 {
+			continue
+		}
+		var item models.Item
+		if err := db.First(&item, line.ItemID).Error; err == gorm.ErrRecordNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		price, err := models.PriceAt(db, item, invoice.Date)
+		if err != nil {
+			return err
+		}
+		if math.Abs(price-line.SellingPrice) < 0.005 {
+			continue
+		}
+		if err := models.RecordPrice(db, item.ID, line.SellingPrice, invoice.Date, models.PriceSourceKalkulacija); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetInvoiceDetails shows the view page for an invoice
 func (ic *InvoiceHandler) GetInvoiceDetails(c *gin.Context) {
-	id := c.Param("id")
+	id := paramID(c, "id")
 
-	var company models.Company
-	if err := ic.DB.First(&company).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
-			"error": "Could not load company: " + err.Error(),
-		})
-		return
-	}
+	company := activeCompany(c)
 
 	var invoice models.Invoice
-	if err := ic.DB.Preload("Supplier").Preload("LineItems").First(&invoice, id).Error; err != nil {
+	if err := ic.DB.Scopes(inCompany(c)).Preload("Supplier").Preload("Location").Preload("LineItems", models.OrderedLines).First(&invoice, id).Error; err != nil {
 		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
 			"error": "Invoice not found",
 		})
 		return
 	}
 
+	// The pictures themselves are served by /invoices/:id/images
+	images, err := models.InvoiceImages(ic.DB, invoice, false)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Could not load company images: " + err.Error(),
+		})
+		return
+	}
+
+	invoice.ApplySnapshot(&company)
+
 	c.HTML(http.StatusOK, "invoice-full.html", gin.H{
 		"Invoice":   invoice,
+		"Recap":     invoice.Recapitulation(),
 		"Company":   company,
+		"Images":    images,
 		"TodayDate": time.Now().Format("02.01.2006"),
 		"active":    "invoices",
 		"Title":     "Invoice Details",
 	})
 }
 
+// GetInvoiceImage serves a logo, stamp or signature the invoice is printed with
+func (ic *InvoiceHandler) GetInvoiceImage(c *gin.Context) {
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, paramID(c, "id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	images, err := models.InvoiceImages(ic.DB, invoice, true)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	image, ok := images[c.Param("kind")]
+	if !ok {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.Data(http.StatusOK, image.ContentType, image.Data)
+}
+
 func (ic *InvoiceHandler) DeleteInvoice(c *gin.Context) {
-	id := c.Param("id")
+	id := paramID(c, "id")
+
+	// Numbered kalkulacije stay in the book, deleting them would leave a gap in the numbering
+	var invoice models.Invoice
+	if err := ic.DB.Scopes(inCompany(c)).First(&invoice, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+	if invoice.Sequence != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice " + invoice.InternalNumber + " is numbered and cannot be deleted"})
+		return
+	}
 
 	// First delete all line items
 	if err := ic.DB.Where("invoice_id = ?", id).Delete(&models.InvoiceItem{}).Error; err != nil {
@@ -331,6 +748,11 @@ func (ic *InvoiceHandler) DeleteInvoice(c *gin.Context) {
 		return
 	}
 
+	if err := ic.DB.Where("invoice_id = ?", id).Delete(&models.ImportLine{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete imported lines"})
+		return
+	}
+
 	// Then delete the invoice
 	if err := ic.DB.Delete(&models.Invoice{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete invoice"})
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"invoicing-item-app/csv"
 	"invoicing-item-app/models"
@@ -26,7 +27,7 @@ func NewItemHandler(db *gorm.DB) *ItemHandler {
 
 func (h *ItemHandler) GetItems(c *gin.Context) {
 	var items []models.Item
-	query := h.DB
+	query := h.DB.Scopes(inCompany(c)).Preload("VatRate").Order("archived, id")
 
 	query.Find(&items)
 	c.HTML(http.StatusOK, "index.html", gin.H{
@@ -38,7 +39,7 @@ func (h *ItemHandler) GetItems(c *gin.Context) {
 
 func (h *ItemHandler) GetItemsPartial(c *gin.Context) {
 	var items []models.Item
-	query := h.DB
+	query := h.DB.Scopes(inCompany(c)).Preload("VatRate").Order("archived, id")
 
 	query.Find(&items)
 	c.HTML(http.StatusOK, "items_list.html", gin.H{
@@ -46,45 +47,161 @@ func (h *ItemHandler) GetItemsPartial(c *gin.Context) {
 	})
 }
 
+// PurchaseRecord is a single purchase of an item taken from a supplier invoice
+type PurchaseRecord struct {
+	InvoiceID      uint
+	Date           time.Time
+	DocumentNumber string
+	SupplierName   string
+	Quantity       float64
+	Price          float64
+	Discount       float64
+	BuyingPrice    float64
+}
+
+func (h *ItemHandler) GetItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var item models.Item
+	if err := h.DB.Scopes(inCompany(c)).Preload("VatRate").First(&item, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var purchases []PurchaseRecord
+	err := h.DB.Table("invoice_items").
+		Select("invoices.id AS invoice_id, invoices.date, invoices.document_number, suppliers.name AS supplier_name, "+
+			"invoice_items.quantity, invoice_items.price, invoice_items.discount, invoice_items.buying_price").
+		Joins("JOIN invoices ON invoices.id = invoice_items.invoice_id AND invoices.deleted_at IS NULL").
+		Joins("LEFT JOIN suppliers ON suppliers.id = invoices.supplier_id").
+		Where("invoice_items.item_id = ?", item.ID).
+		Order("invoices.date DESC").
+		Scan(&purchases).Error
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var sellingPrices []models.ItemPrice
+	if err := h.DB.Where("item_id = ?", item.ID).Order("valid_from DESC, id DESC").Find(&sellingPrices).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Answer "what was the price on a given day" when a date is requested
+	priceDate := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		if date, err := time.Parse("2006-01-02", dateStr); err == nil {
+			priceDate = date
+		}
+	}
+	priceAtDate, err := models.PriceAt(h.DB, item, priceDate)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"item":          item,
+		"purchases":     purchases,
+		"sellingPrices": sellingPrices,
+		"priceDate":     priceDate.Format("2006-01-02"),
+		"priceAtDate":   priceAtDate,
+		"active":        "items",
+		"Title":         item.Name,
+	})
+}
+
 func (h *ItemHandler) CreateItem(c *gin.Context) {
 	var item models.Item
 	if err := c.Bind(&item); err != nil {
 		c.String(http.StatusBadRequest, "Bad request")
 		return
 	}
-	h.DB.Create(&item)
+	if err := applyVatRate(h.DB, &item); err != nil {
+		c.String(http.StatusBadRequest, "Invalid VAT rate")
+		return
+	}
+	item.CompanyID = activeCompany(c).ID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("VatRate").Create(&item).Error; err != nil {
+			return err
+		}
+		return models.RecordPrice(tx, item.ID, item.Price, time.Now(), models.PriceSourceManual)
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
 	c.HTML(http.StatusCreated, "item.html", item)
 }
 
 func (h *ItemHandler) DeleteItem(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var item models.Item
-	if err := h.DB.First(&item, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&item, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
+
+	// Kalkulacije keep pointing at the item, so it can only be archived
+	hasDocuments, err := models.ItemHasDocuments(h.DB, item.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hasDocuments {
+		c.String(http.StatusConflict, "Proizvod %s se nalazi na kalkulacijama i ne može se obrisati, možete ga arhivirati.", item.Name)
+		return
+	}
+
 	h.DB.Delete(&item)
 	c.String(http.StatusOK, "")
 }
 
+// ArchiveItem stops offering the item on new kalkulacije
+func (h *ItemHandler) ArchiveItem(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// RestoreItem makes an archived item available again
+func (h *ItemHandler) RestoreItem(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+func (h *ItemHandler) setArchived(c *gin.Context, archived bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var item models.Item
+	if err := h.DB.Scopes(inCompany(c)).Preload("VatRate").First(&item, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if err := h.DB.Model(&item).Update("archived", archived).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusOK, "item.html", item)
+}
+
 func (h *ItemHandler) GetItemCreateForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "item-create-form.html", gin.H{})
+	vatRates, _ := models.CurrentVatRates(h.DB, time.Now())
+	c.HTML(http.StatusOK, "item-create-form.html", gin.H{"vatRates": vatRates})
 }
 
 func (h *ItemHandler) GetItemEditForm(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var item models.Item
-	if err := h.DB.First(&item, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&item, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
-	c.HTML(http.StatusOK, "item-edit-form.html", gin.H{"item": item})
+	vatRates, _ := models.CurrentVatRates(h.DB, time.Now())
+	c.HTML(http.StatusOK, "item-edit-form.html", gin.H{"item": item, "vatRates": vatRates})
 }
 
 func (h *ItemHandler) UpdateItem(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var item models.Item
-	if err := h.DB.First(&item, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&item, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
@@ -95,19 +212,43 @@ func (h *ItemHandler) UpdateItem(c *gin.Context) {
 		return
 	}
 
+	priceChanged := item.Price != updatedItem.Price
+
 	// Update fields while preserving ID
 	item.Name = updatedItem.Name
 	item.Price = updatedItem.Price
 	item.Unit = updatedItem.Unit
-	item.TaxRate = updatedItem.TaxRate
+	item.VatRateID = updatedItem.VatRateID
 
-	h.DB.Save(&item)
+	if err := applyVatRate(h.DB, &item); err != nil {
+		c.String(http.StatusBadRequest, "Invalid VAT rate")
+		return
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("VatRate").Save(&item).Error; err != nil {
+			return err
+		}
+		if !priceChanged {
+			return nil
+		}
+		return models.RecordPrice(tx, item.ID, item.Price, time.Now(), models.PriceSourceManual)
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
 	c.HTML(http.StatusOK, "item.html", item)
 }
 
+// applyVatRate loads the item's VAT rate, the item's percentage is the one of the rate
+func applyVatRate(db *gorm.DB, item *models.Item) error {
+	item.VatRate = models.VatRate{}
+	return db.First(&item.VatRate, item.VatRateID).Error
+}
+
 func (h *ItemHandler) ExportItems(c *gin.Context) {
 	var items []models.Item
-	h.DB.Find(&items)
+	h.DB.Scopes(inCompany(c)).Preload("VatRate").Find(&items)
 
 	csvData, err := csv.ExportItemsToCSV(items)
 	if err != nil {
@@ -137,7 +278,7 @@ func (h *ItemHandler) ImportItems(c *gin.Context) {
 	defer os.Remove(tempFile)
 
 	// Import items from the CSV file (this will save to DefaultCSVFile and call Populate)
-	if err := csv.ImportItemsFromCSV(tempFile, h.DB); err != nil {
+	if err := csv.ImportItemsFromCSV(tempFile, h.DB, activeCompany(c).ID); err != nil {
 		c.String(http.StatusInternalServerError, "Error importing items: %v", err)
 		return
 	}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"invoicing-item-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// The active location is remembered per browser
+const locationCookie = "location"
+
+type LocationHandler struct {
+	DB *gorm.DB
+}
+
+func NewLocationHandler(db *gorm.DB) *LocationHandler {
+	return &LocationHandler{DB: db}
+}
+
+// activeLocation returns the location picked in the switcher, or nil when all locations are shown.
+// A location of another company is ignored, so switching the company shows all of its locations.
+func activeLocation(db *gorm.DB, c *gin.Context) *models.Location {
+	value, err := c.Cookie(locationCookie)
+	if err != nil || value == "" {
+		return nil
+	}
+	id, ok := parseID(value)
+	if !ok {
+		return nil
+	}
+	var location models.Location
+	if err := db.Scopes(inCompany(c)).First(&location, id).Error; err != nil {
+		return nil
+	}
+	return &location
+}
+
+// activeLocationID returns the ID of the location new documents belong to. While all locations
+// are shown they go to the first one, a document without a location would drop out of every
+// filtered view. Companies without locations keep documents without one.
+func activeLocationID(db *gorm.DB, c *gin.Context) *uint {
+	if location := activeLocation(db, c); location != nil {
+		return &location.ID
+	}
+	var first models.Location
+	if err := db.Scopes(inCompany(c)).Order("id").First(&first).Error; err == nil {
+		return &first.ID
+	}
+	return nil
+}
+
+// scopeLocation limits a query on invoices to the active location
+func scopeLocation(db *gorm.DB, c *gin.Context) func(*gorm.DB) *gorm.DB {
+	location := activeLocation(db, c)
+	return func(query *gorm.DB) *gorm.DB {
+		if location == nil {
+			return query
+		}
+		return query.Where("invoices.location_id = ?", location.ID)
+	}
+}
+
+func (h *LocationHandler) GetLocations(c *gin.Context) {
+	var locations []models.Location
+	h.DB.Scopes(inCompany(c)).Order("name").Find(&locations)
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"locations": locations,
+		"active":    "locations",
+		"Title":     "Locations",
+	})
+}
+
+func (h *LocationHandler) CreateLocation(c *gin.Context) {
+	var location models.Location
+	if err := c.Bind(&location); err != nil || location.Name == "" {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+	location.CompanyID = activeCompany(c).ID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+		return models.AssignUnlocatedInvoices(tx)
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusCreated, "location.html", location)
+}
+
+func (h *LocationHandler) DeleteLocation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var location models.Location
+	if err := h.DB.Scopes(inCompany(c)).First(&location, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	hasDocuments, err := models.LocationHasDocuments(h.DB, location.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hasDocuments {
+		c.String(http.StatusConflict, "Prodavnica %s ima kalkulacije i ne može se obrisati.", location.Name)
+		return
+	}
+
+	h.DB.Delete(&location)
+	c.String(http.StatusOK, "")
+}
+
+// GetLocationSwitcher renders the location picker shown in the navigation bar
+func (h *LocationHandler) GetLocationSwitcher(c *gin.Context) {
+	var locations []models.Location
+	h.DB.Scopes(inCompany(c)).Order("name").Find(&locations)
+
+	var activeID uint
+	if location := activeLocation(h.DB, c); location != nil {
+		activeID = location.ID
+	}
+	c.HTML(http.StatusOK, "location-switcher.html", gin.H{
+		"locations": locations,
+		"activeID":  activeID,
+	})
+}
+
+// SelectLocation makes a location active, an empty selection shows all locations
+func (h *LocationHandler) SelectLocation(c *gin.Context) {
+	value := c.PostForm("location_id")
+	if value != "" {
+		id, ok := parseID(value)
+		var location models.Location
+		if !ok || h.DB.Scopes(inCompany(c)).First(&location, id).Error != nil {
+			c.String(http.StatusNotFound, "Not found")
+			return
+		}
+	}
+	c.SetCookie(locationCookie, value, 365*24*60*60, "/", "", false, true)
+
+	back := c.Request.Referer()
+	if back == "" {
+		back = "/invoices"
+	}
+	c.Redirect(http.StatusFound, back)
+}
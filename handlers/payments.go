@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"invoicing-item-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PaymentHandler struct {
+	DB *gorm.DB
+}
+
+func NewPaymentHandler(db *gorm.DB) *PaymentHandler {
+	return &PaymentHandler{DB: db}
+}
+
+// SupplierPayables sums what is owed to one supplier, split by how long it is overdue
+type SupplierPayables struct {
+	Supplier    models.Supplier
+	Outstanding float64
+	NotDue      float64
+	Overdue     [4]float64 // Indexed like models.AgingBuckets
+	Invoices    []models.Invoice
+}
+
+func (h *PaymentHandler) loadInvoice(c *gin.Context) (models.Invoice, bool) {
+	var invoice models.Invoice
+	err := h.DB.Scopes(inCompany(c)).Preload("Supplier").Preload("Payments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date, id")
+	}).First(&invoice, paramID(c, "id")).Error
+	if err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+			"error": "Invoice not found",
+		})
+		return invoice, false
+	}
+	return invoice, true
+}
+
+func paymentsData(invoice models.Invoice, errors map[string]string) gin.H {
+	return gin.H{
+		"paymentInvoice": invoice,
+		"paymentMethods": models.PaymentMethods,
+		"errors":         errors,
+		"TodayDate":      time.Now().Format("2006-01-02"),
+		"today":          time.Now(),
+	}
+}
+
+// GetInvoicePayments shows the due date and the payments of an invoice
+func (h *PaymentHandler) GetInvoicePayments(c *gin.Context) {
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	data := paymentsData(invoice, nil)
+	data["active"] = "payables"
+	data["Title"] = "Payments"
+	c.HTML(http.StatusOK, "index.html", data)
+}
+
+func (h *PaymentHandler) UpdateDueDate(c *gin.Context) {
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	dueDate, err := time.Parse("2006-01-02", c.PostForm("due_date"))
+	if err != nil {
+		c.HTML(http.StatusUnprocessableEntity, "invoice-payments.html", paymentsData(invoice, map[string]string{
+			"DueDate": "Neispravan datum dospeća",
+		}))
+		return
+	}
+
+	invoice.DueDate = &dueDate
+	if err := h.DB.Model(&invoice).Update("due_date", dueDate).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusOK, "invoice-payments.html", paymentsData(invoice, nil))
+}
+
+// CreatePayment records a full or partial payment of the invoice
+func (h *PaymentHandler) CreatePayment(c *gin.Context) {
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var payment models.Payment
+	if err := c.Bind(&payment); err != nil {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+	payment.InvoiceID = invoice.ID
+
+	errors := make(map[string]string)
+	date, err := time.Parse("2006-01-02", c.PostForm("Date"))
+	if err != nil {
+		errors["Date"] = "Neispravan datum plaćanja"
+	}
+	payment.Date = date
+	if !models.ValidPaymentMethod(payment.Method) {
+		errors["Method"] = "Nepoznat način plaćanja"
+	}
+	if !invoice.Completed() {
+		errors["Invoice"] = "Kalkulacija nije završena"
+	} else if payment.Amount <= 0 {
+		errors["Amount"] = "Iznos mora biti veći od nule"
+	} else if payment.Amount > invoice.Outstanding()+0.005 {
+		errors["Amount"] = "Iznos je veći od preostalog duga"
+	}
+	if len(errors) > 0 {
+		c.HTML(http.StatusUnprocessableEntity, "invoice-payments.html", paymentsData(invoice, errors))
+		return
+	}
+
+	if err := h.DB.Create(&payment).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	invoice.Payments = append(invoice.Payments, payment)
+	c.HTML(http.StatusCreated, "invoice-payments.html", paymentsData(invoice, nil))
+}
+
+// DeletePayment removes a payment. A bank statement line it was recorded from goes back to
+// waiting for confirmation, so it can be confirmed again or paired with another invoice.
+func (h *PaymentHandler) DeletePayment(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Invoice{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	paymentID := paramID(c, "payment_id")
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("invoice_id = ?", paramID(c, "id")).Delete(&models.Payment{}, paymentID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.BankTransaction{}).Where("payment_id = ?", paymentID).Updates(map[string]interface{}{
+			"status":     models.TransactionSuggested,
+			"payment_id": nil,
+		}).Error
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+	c.HTML(http.StatusOK, "invoice-payments.html", paymentsData(invoice, nil))
+}
+
+// GetPayables lists unpaid supplier invoices grouped by supplier with overdue amounts aged into buckets
+func (h *PaymentHandler) GetPayables(c *gin.Context) {
+	query := h.DB.Scopes(inCompany(c), scopeLocation(h.DB, c)).Preload("Supplier").Preload("Payments").Where("completed_at IS NOT NULL")
+	supplierID, _ := strconv.Atoi(c.Query("supplier_id"))
+	if supplierID != 0 {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var invoices []models.Invoice
+	if err := query.Order("due_date, id").Find(&invoices).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load invoices: " + err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	bySupplier := make(map[uint]*SupplierPayables)
+	var total SupplierPayables
+	for _, invoice := range invoices {
+		outstanding := invoice.Outstanding()
+		if outstanding <= 0 {
+			continue
+		}
+
+		payables, ok := bySupplier[invoice.SupplierID]
+		if !ok {
+			payables = &SupplierPayables{Supplier: invoice.Supplier}
+			bySupplier[invoice.SupplierID] = payables
+		}
+		for _, p := range []*SupplierPayables{payables, &total} {
+			p.Outstanding += outstanding
+			if days := invoice.DaysOverdue(now); days > 0 {
+				p.Overdue[models.AgingBucket(days)] += outstanding
+			} else {
+				p.NotDue += outstanding
+			}
+		}
+		payables.Invoices = append(payables.Invoices, invoice)
+	}
+
+	suppliers := make([]SupplierPayables, 0, len(bySupplier))
+	for _, payables := range bySupplier {
+		suppliers = append(suppliers, *payables)
+	}
+	sort.Slice(suppliers, func(i, j int) bool {
+		return suppliers[i].Supplier.Name < suppliers[j].Supplier.Name
+	})
+
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"payables":      suppliers,
+		"payablesTotal": total,
+		"agingBuckets":  models.AgingBuckets,
+		"showInvoices":  supplierID != 0,
+		"today":         now,
+		"active":        "payables",
+		"Title":         "Payables",
+	})
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"invoicing-item-app/models"
+	"invoicing-item-app/pdf"
+	"invoicing-item-app/xlsx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Layout of the supplier ledger card, A4 portrait in points
+const (
+	ledgerPageWidth  = pdf.A4Width
+	ledgerPageHeight = pdf.A4Height
+	ledgerRowHeight  = 13.0
+)
+
+// ledgerColumns are the titles and widths of the ledger table
+var ledgerColumns = []struct {
+	Title string
+	Width float64
+	Align string
+}{
+	{"Datum", 52, "center"},
+	{"Dokument", 80, "left"},
+	{"Opis", 187, "left"},
+	{"Duguje", 70, "right"},
+	{"Potražuje", 70, "right"},
+	{"Saldo", 80, "right"},
+}
+
+// GetSupplierLedger shows the supplier ledger card (kartica dobavljača) for a period, or exports
+// it as PDF or XLSX to be sent to the supplier for confirmation of the balance (IOS)
+func (h *SupplierHandler) GetSupplierLedger(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var supplier models.Supplier
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from, to := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC), today
+	var err error
+	if c.Query("from") != "" {
+		if from, err = time.Parse("2006-01-02", c.Query("from")); err != nil {
+			c.String(http.StatusBadRequest, "Invalid start date")
+			return
+		}
+	}
+	if c.Query("to") != "" {
+		if to, err = time.Parse("2006-01-02", c.Query("to")); err != nil || to.Before(from) {
+			c.String(http.StatusBadRequest, "Invalid end date")
+			return
+		}
+	}
+
+	var locationID uint
+	if location := activeLocation(h.DB, c); location != nil {
+		locationID = location.ID
+	}
+	ledger, err := models.BuildSupplierLedger(h.DB, supplier, locationID, from, to)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+			"error": "Failed to load ledger: " + err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("kartica_%s_%s_%s", supplier.PIB, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	switch c.Query("format") {
+	case "pdf":
+		company := activeCompany(c)
+
+		doc := pdf.New(ledgerPageWidth, ledgerPageHeight)
+		doc.Title = "Kartica dobavljača " + supplier.Name
+		images, err := loadDocumentImages(h.DB, doc, company.ID)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not load company images: " + err.Error(),
+			})
+			return
+		}
+		renderSupplierLedger(doc, company, images, ledger, today.Format("02.01.2006"))
+		data, err := doc.Bytes()
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"error": "Could not create PDF: " + err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", filename))
+		c.Data(http.StatusOK, "application/pdf", data)
+
+	case "xlsx":
+		var buf bytes.Buffer
+		if err := xlsx.WriteRows(&buf, "Kartica", ledgerRows(ledger)); err != nil {
+			c.String(http.StatusInternalServerError, "Error exporting ledger: %v", err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", filename))
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+
+	default:
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"ledger": ledger,
+			"active": "suppliers",
+			"Title":  "Kartica - " + supplier.Name,
+		})
+	}
+}
+
+// ledgerRows lays out the ledger card as worksheet rows
+func ledgerRows(ledger models.SupplierLedger) [][]interface{} {
+	period := fmt.Sprintf("%s - %s", ledger.From.Format("02.01.2006"), ledger.To.Format("02.01.2006"))
+	rows := [][]interface{}{
+		{xlsx.Bold("Kartica dobavljača"), ledger.Supplier.Name},
+		{"PIB", ledger.Supplier.PIB},
+		{"Period", period},
+		{},
+		{xlsx.Bold("Datum"), xlsx.Bold("Dokument"), xlsx.Bold("Opis"), xlsx.Bold("Duguje"), xlsx.Bold("Potražuje"), xlsx.Bold("Saldo")},
+		{ledger.From.Format("02.01.2006"), nil, "Početno stanje", nil, nil, ledger.Opening},
+	}
+	for _, entry := range ledger.Entries {
+		rows = append(rows, []interface{}{
+			entry.Date.Format("02.01.2006"), entry.Document, entry.Description, entry.Debit, entry.Credit, entry.Balance,
+		})
+	}
+	return append(rows,
+		[]interface{}{nil, nil, xlsx.Bold("Promet u periodu"), ledger.Debit, ledger.Credit, nil},
+		[]interface{}{ledger.To.Format("02.01.2006"), nil, xlsx.Bold("Saldo"), nil, nil, ledger.Closing},
+	)
+}
+
+// ledgerRow writes one row of the ledger table; empty values leave the cell blank
+func ledgerRow(page *pdf.Page, y float64, bold bool, values ...string) {
+	x := pageMargin
+	for i, column := range ledgerColumns {
+		page.Rect(x, y, column.Width, ledgerRowHeight, 0.5)
+		if values[i] != "" {
+			cellText(page, x, y+9, column.Width, column.Align, bold, values[i])
+		}
+		x += column.Width
+	}
+}
+
+// renderSupplierLedger adds the ledger card with the balance confirmation form to the document.
+// The supplier takes the right side of the header, so a logo placed right is centered instead.
+// The company always signs on the left, with the stamp in the middle.
+func renderSupplierLedger(doc *pdf.Document, company models.Company, images documentImages, ledger models.SupplierLedger, printDate string) {
+	bottom := ledgerPageHeight - pageMargin - 14
+	supplier := ledger.Supplier
+
+	page := doc.AddPage()
+	x, headerBottom := pageMargin, 0.0
+	if logo, ok := images[models.ImageLogo]; ok {
+		width := logo.ScaledWidth(logo.Height)
+		if logo.Position == models.PositionRight {
+			page.Image(logo.Image, (ledgerPageWidth-width)/2, pageMargin, logo.Height)
+		} else {
+			page.Image(logo.Image, pageMargin, pageMargin, logo.Height)
+			x += width + 8
+		}
+		headerBottom = pageMargin + logo.Height
+	}
+	page.Text(x, pageMargin+10, 8, true, company.Name)
+	page.Text(x, pageMargin+21, 8, false, company.Address)
+	labeledText(page, x, pageMargin+32, 8, "PIB:", company.Code)
+	labeledText(page, x, pageMargin+43, 8, "Matični broj:", company.RegistrationNumber)
+
+	right := ledgerPageWidth - pageMargin
+	lines := []string{supplier.Name, supplier.FullAddress(), "PIB: " + supplier.PIB}
+	if supplier.RegistrationNumber != "" {
+		lines = append(lines, "Matični broj: "+supplier.RegistrationNumber)
+	}
+	y := pageMargin + 10
+	for _, line := range lines {
+		page.TextRight(right, y, 8, line == supplier.Name, line)
+		y += 11
+	}
+
+	y = math.Max(y, headerBottom) + 20
+	page.TextCenter(ledgerPageWidth/2, y, 13, true, "KARTICA DOBAVLJAČA")
+	y += 14
+	page.TextCenter(ledgerPageWidth/2, y, 9, false, fmt.Sprintf("za period od %s do %s godine",
+		ledger.From.Format("02.01.2006"), ledger.To.Format("02.01.2006")))
+	y += 16
+
+	header := func(page *pdf.Page, y float64) float64 {
+		x := pageMargin
+		page.FillRect(pageMargin, y, ledgerPageWidth-2*pageMargin, ledgerRowHeight, 0.92)
+		for _, column := range ledgerColumns {
+			page.Rect(x, y, column.Width, ledgerRowHeight, 0.5)
+			page.TextCenter(x+column.Width/2, y+9, headerFont, true, column.Title)
+			x += column.Width
+		}
+		return y + ledgerRowHeight
+	}
+
+	y = header(page, y)
+	ledgerRow(page, y, true, ledger.From.Format("02.01.2006"), "", "Početno stanje", "", "", amount(ledger.Opening))
+	y += ledgerRowHeight
+	for _, entry := range ledger.Entries {
+		if y+ledgerRowHeight > bottom {
+			page = doc.AddPage()
+			y = header(page, pageMargin)
+		}
+		ledgerRow(page, y, false, entry.Date.Format("02.01.2006"), entry.Document, entry.Description,
+			amount(entry.Debit), amount(entry.Credit), amount(entry.Balance))
+		y += ledgerRowHeight
+	}
+
+	// Totals and the confirmation form stay together
+	if y+2*ledgerRowHeight+150 > bottom {
+		page = doc.AddPage()
+		y = pageMargin
+	}
+	ledgerRow(page, y, true, "", "", "Promet u periodu", amount(ledger.Debit), amount(ledger.Credit), "")
+	y += ledgerRowHeight
+	ledgerRow(page, y, true, ledger.To.Format("02.01.2006"), "", "Saldo", "", "", amount(ledger.Closing))
+	y += ledgerRowHeight + 24
+
+	statement := fmt.Sprintf("Prema našim poslovnim knjigama na dan %s godine iskazujemo obavezu prema Vama u iznosu od %s dinara.",
+		ledger.To.Format("02.01.2006"), amount(ledger.Closing))
+	if ledger.Closing < 0 {
+		statement = fmt.Sprintf("Prema našim poslovnim knjigama na dan %s godine iskazujemo potraživanje od Vas u iznosu od %s dinara.",
+			ledger.To.Format("02.01.2006"), amount(-ledger.Closing))
+	}
+	for _, text := range []string{statement, "Molimo Vas da saldo potvrdite ili u roku od 8 dana od prijema osporite."} {
+		for _, line := range pdf.Wrap(text, ledgerPageWidth-2*pageMargin, 9, false) {
+			page.Text(pageMargin, y, 9, false, line)
+			y += 12
+		}
+	}
+
+	y += 40
+	signatureWidth := 180.0
+	page.Line(pageMargin, y, pageMargin+signatureWidth, y, 0.5)
+	page.Line(right-signatureWidth, y, right, y, 0.5)
+	page.TextCenter(pageMargin+signatureWidth/2, y+10, 8, false, "Za "+company.Name)
+	page.TextCenter(right-signatureWidth/2, y+10, 8, false, "Saldo potvrđuje "+supplier.Name)
+	page.TextCenter(ledgerPageWidth/2, y+10, 8, false, "M.P.")
+	drawStampAndSignature(page, images, y, ledgerPageWidth/2, pageMargin+signatureWidth/2)
+
+	pages := doc.Pages()
+	for i, p := range pages {
+		p.Text(pageMargin, ledgerPageHeight-pageMargin+4, 7, false, "Datum štampe: "+printDate)
+		p.TextRight(right, ledgerPageHeight-pageMargin+4, 7, false, fmt.Sprintf("Strana %d/%d", i+1, len(pages)))
+	}
+}
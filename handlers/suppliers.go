@@ -19,7 +19,7 @@ func NewSupplierHandler(db *gorm.DB) *SupplierHandler {
 
 func (h *SupplierHandler) GetSuppliers(c *gin.Context) {
 	var suppliers []models.Supplier
-	h.DB.Find(&suppliers)
+	h.DB.Scopes(inCompany(c)).Order("archived, id").Find(&suppliers)
 	c.HTML(http.StatusOK, "index.html", gin.H{
 		"suppliers": suppliers,
 		"active":    "suppliers",
@@ -29,9 +29,19 @@ func (h *SupplierHandler) GetSuppliers(c *gin.Context) {
 
 func (h *SupplierHandler) GetSuppliersPartial(c *gin.Context) {
 	var suppliers []models.Supplier
-	h.DB.Find(&suppliers)
+	h.DB.Scopes(inCompany(c)).Order("archived, id").Find(&suppliers)
+
+	// Suppliers entered before validation may carry mistyped tax identifiers
+	invalid := 0
+	for _, supplier := range suppliers {
+		if len(supplier.Validate()) > 0 {
+			invalid++
+		}
+	}
+
 	c.HTML(http.StatusOK, "suppliers_list.html", gin.H{
 		"suppliers": suppliers,
+		"invalid":   invalid,
 	})
 }
 
@@ -41,29 +51,78 @@ func (h *SupplierHandler) CreateSupplier(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Bad request")
 		return
 	}
+	supplier.TrimIdentifiers()
+	if errors := supplier.Validate(); len(errors) > 0 {
+		invalidForm(c, "#supplierForm", "supplier-create-form.html", gin.H{"supplier": supplier, "errors": errors})
+		return
+	}
+	supplier.CompanyID = activeCompany(c).ID
 	h.DB.Create(&supplier)
 	c.HTML(http.StatusCreated, "supplier.html", supplier)
 }
 
+// invalidForm renders the form again with its errors in place of the submitted one
+func invalidForm(c *gin.Context, target, template string, data gin.H) {
+	c.Header("HX-Retarget", target)
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusUnprocessableEntity, template, data)
+}
+
 func (h *SupplierHandler) DeleteSupplier(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var supplier models.Supplier
-	if err := h.DB.First(&supplier, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
+
+	// Invoices keep pointing at the supplier, so it can only be archived
+	hasDocuments, err := models.SupplierHasDocuments(h.DB, supplier.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hasDocuments {
+		c.String(http.StatusConflict, "Dobavljač %s ima fakture i ne može se obrisati, možete ga arhivirati.", supplier.Name)
+		return
+	}
+
 	h.DB.Delete(&supplier)
 	c.String(http.StatusOK, "")
 }
 
+// ArchiveSupplier hides the supplier from the pickers for new invoices
+func (h *SupplierHandler) ArchiveSupplier(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// RestoreSupplier makes an archived supplier available again
+func (h *SupplierHandler) RestoreSupplier(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+func (h *SupplierHandler) setArchived(c *gin.Context, archived bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var supplier models.Supplier
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if err := h.DB.Model(&supplier).Update("archived", archived).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusOK, "supplier.html", supplier)
+}
+
 func (h *SupplierHandler) GetSupplierCreateForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "supplier-create-form.html", gin.H{})
+	c.HTML(http.StatusOK, "supplier-create-form.html", gin.H{"supplier": models.Supplier{}})
 }
 
 func (h *SupplierHandler) GetSupplierEditForm(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var supplier models.Supplier
-	if err := h.DB.First(&supplier, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
@@ -73,7 +132,7 @@ func (h *SupplierHandler) GetSupplierEditForm(c *gin.Context) {
 func (h *SupplierHandler) UpdateSupplier(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var supplier models.Supplier
-	if err := h.DB.First(&supplier, id).Error; err != nil {
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
 		c.String(http.StatusNotFound, "Not found")
 		return
 	}
@@ -87,8 +146,192 @@ func (h *SupplierHandler) UpdateSupplier(c *gin.Context) {
 	// Update fields while preserving ID
 	supplier.Name = updatedSupplier.Name
 	supplier.Code = updatedSupplier.Code
+	supplier.PIB = updatedSupplier.PIB
 	supplier.Address = updatedSupplier.Address
+	supplier.RegistrationNumber = updatedSupplier.RegistrationNumber
+	supplier.PostalCode = updatedSupplier.PostalCode
+	supplier.City = updatedSupplier.City
+	supplier.ContactPerson = updatedSupplier.ContactPerson
+	supplier.Phone = updatedSupplier.Phone
+	supplier.Email = updatedSupplier.Email
+	supplier.PaymentTermDays = updatedSupplier.PaymentTermDays
+	supplier.TrimIdentifiers()
 
+	if errors := supplier.Validate(); len(errors) > 0 {
+		invalidForm(c, "#supplierForm", "supplier-edit-form.html", gin.H{"supplier": supplier, "errors": errors})
+		return
+	}
 	h.DB.Save(&supplier)
 	c.HTML(http.StatusOK, "supplier.html", supplier)
 }
+
+func (h *SupplierHandler) GetSupplier(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var supplier models.Supplier
+	if err := h.DB.Scopes(inCompany(c)).Preload("BankAccounts").First(&supplier, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var supplierItems []models.SupplierItem
+	h.DB.Preload("Item").Where("supplier_id = ?", supplier.ID).Order("supplier_name").Find(&supplierItems)
+
+	var items []models.Item
+	h.DB.Scopes(inCompany(c), models.Active).Find(&items)
+
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"supplier":      supplier,
+		"supplierItems": supplierItems,
+		"items":         items,
+		"active":        "suppliers",
+		"Title":         supplier.Name,
+	})
+}
+
+func (h *SupplierHandler) CreateSupplierItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var supplier models.Supplier
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var supplierItem models.SupplierItem
+	if err := c.Bind(&supplierItem); err != nil {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+	supplierItem.SupplierID = supplier.ID
+	if !inActiveCompany(h.DB, c, &models.Item{}, supplierItem.ItemID) {
+		c.String(http.StatusBadRequest, "Unknown item")
+		return
+	}
+
+	if err := h.DB.Create(&supplierItem).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.DB.First(&supplierItem.Item, supplierItem.ItemID)
+	c.HTML(http.StatusCreated, "supplier-item.html", supplierItem)
+}
+
+func (h *SupplierHandler) GetSupplierItem(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Supplier{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	var supplierItem models.SupplierItem
+	if err := h.DB.Preload("Item").Where("supplier_id = ?", paramID(c, "id")).First(&supplierItem, paramID(c, "item_id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.HTML(http.StatusOK, "supplier-item.html", supplierItem)
+}
+
+func (h *SupplierHandler) GetSupplierItemEditForm(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Supplier{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	var supplierItem models.SupplierItem
+	if err := h.DB.Where("supplier_id = ?", paramID(c, "id")).First(&supplierItem, paramID(c, "item_id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	// The item currently mapped stays selectable even when it has been archived since
+	var items []models.Item
+	h.DB.Scopes(inCompany(c)).Where("archived = ? OR id = ?", false, supplierItem.ItemID).Find(&items)
+	c.HTML(http.StatusOK, "supplier-item-edit-form.html", gin.H{
+		"supplierItem": supplierItem,
+		"items":        items,
+	})
+}
+
+func (h *SupplierHandler) UpdateSupplierItem(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Supplier{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	var supplierItem models.SupplierItem
+	if err := h.DB.Where("supplier_id = ?", paramID(c, "id")).First(&supplierItem, paramID(c, "item_id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var updatedSupplierItem models.SupplierItem
+	if err := c.Bind(&updatedSupplierItem); err != nil {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+
+	// Update fields while preserving ID and supplier
+	supplierItem.SupplierCode = updatedSupplierItem.SupplierCode
+	supplierItem.SupplierName = updatedSupplierItem.SupplierName
+	supplierItem.ItemID = updatedSupplierItem.ItemID
+	supplierItem.LastPrice = updatedSupplierItem.LastPrice
+	supplierItem.LastDiscount = updatedSupplierItem.LastDiscount
+	if !inActiveCompany(h.DB, c, &models.Item{}, supplierItem.ItemID) {
+		c.String(http.StatusBadRequest, "Unknown item")
+		return
+	}
+
+	h.DB.Omit("Item").Save(&supplierItem)
+	h.DB.First(&supplierItem.Item, supplierItem.ItemID)
+	c.HTML(http.StatusOK, "supplier-item.html", supplierItem)
+}
+
+func (h *SupplierHandler) DeleteSupplierItem(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Supplier{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	var supplierItem models.SupplierItem
+	if err := h.DB.Where("supplier_id = ?", paramID(c, "id")).First(&supplierItem, paramID(c, "item_id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	h.DB.Delete(&supplierItem)
+	c.String(http.StatusOK, "")
+}
+
+func (h *SupplierHandler) CreateSupplierBankAccount(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var supplier models.Supplier
+	if err := h.DB.Scopes(inCompany(c)).First(&supplier, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	account := models.SupplierBankAccount{
+		SupplierID: supplier.ID,
+		Number:     models.NormalizeBankAccount(c.PostForm("Number")),
+		Bank:       c.PostForm("Bank"),
+	}
+	if !models.ValidBankAccount(account.Number) {
+		invalidForm(c, "#bankAccountErrors", "form-errors.html", gin.H{
+			"errors": map[string]string{"Number": "Račun mora imati 18 cifara (npr. 160-0000000012345-67) sa ispravnim kontrolnim brojem"},
+		})
+		return
+	}
+
+	if err := h.DB.Create(&account).Error; err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.HTML(http.StatusCreated, "supplier-bank-account.html", account)
+}
+
+func (h *SupplierHandler) DeleteSupplierBankAccount(c *gin.Context) {
+	if !inActiveCompany(h.DB, c, &models.Supplier{}, paramID(c, "id")) {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	var account models.SupplierBankAccount
+	if err := h.DB.Where("supplier_id = ?", paramID(c, "id")).First(&account, paramID(c, "account_id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	h.DB.Delete(&account)
+	c.String(http.StatusOK, "")
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"invoicing-item-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// The active company is remembered per browser
+	companyCookie = "company"
+	// Context key of the active company
+	companyKey = "company"
+)
+
+// Tenant resolves the active company of every request. Everything except the company form
+// needs a company, so a new installation is sent to the form first. A browser that never picked
+// a company works on the first one, but a cookie naming a company that no longer exists is
+// dropped rather than replaced, writes must not land in the data of another company.
+func Tenant(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var company models.Company
+		var err error
+		if value, cookieErr := c.Cookie(companyCookie); cookieErr == nil && value != "" {
+			if id, ok := parseID(value); ok {
+				err = db.First(&company, id).Error
+			} else {
+				err = gorm.ErrRecordNotFound
+			}
+			if err != nil {
+				c.SetCookie(companyCookie, "", -1, "/", "", false, true)
+				if c.Request.Method == http.MethodGet {
+					c.Redirect(http.StatusFound, "/company")
+				} else {
+					c.String(http.StatusConflict, "Izabrana firma ne postoji, izaberite firmu ponovo")
+				}
+				c.Abort()
+				return
+			}
+		} else {
+			err = db.Order("id").First(&company).Error
+		}
+		if err == nil {
+			c.Set(companyKey, company)
+			c.Next()
+			return
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, "/company") {
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodGet {
+			c.Redirect(http.StatusFound, "/company")
+		} else {
+			c.String(http.StatusConflict, "Please enter the company first")
+		}
+		c.Abort()
+	}
+}
+
+// activeCompany returns the company the request works on
+func activeCompany(c *gin.Context) models.Company {
+	company, _ := c.MustGet(companyKey).(models.Company)
+	return company
+}
+
+// inCompany limits a query to records of the active company
+func inCompany(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	id := activeCompany(c).ID
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "company_id"}, Value: id})
+	}
+}
+
+// parseID reads a record ID from a cookie, form value or URL. The raw string must never reach
+// gorm as an inline condition, anything that is not a positive number is rejected.
+func parseID(value string) (uint, bool) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	return uint(id), err == nil && id > 0
+}
+
+// paramID returns the ID in a URL parameter, 0 matches no record when it is not a number
+func paramID(c *gin.Context, name string) uint {
+	id, _ := parseID(c.Param(name))
+	return id
+}
+
+func uintString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// inActiveCompany reports whether the record with the given ID belongs to the active company.
+// Handlers of nested resources check their parent with it.
+func inActiveCompany(db *gorm.DB, c *gin.Context, model interface{}, id interface{}) bool {
+	var count int64
+	db.Model(model).Scopes(inCompany(c)).Where("id = ?", id).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"invoicing-item-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type VatRateHandler struct {
+	DB *gorm.DB
+}
+
+func NewVatRateHandler(db *gorm.DB) *VatRateHandler {
+	return &VatRateHandler{DB: db}
+}
+
+func (h *VatRateHandler) GetVatRates(c *gin.Context) {
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"active": "vat-rates",
+		"Title":  "VAT rates",
+	})
+}
+
+func (h *VatRateHandler) GetVatRatesPartial(c *gin.Context) {
+	vatRates, _ := models.LoadVatRates(h.DB)
+	c.HTML(http.StatusOK, "vat_rates_list.html", gin.H{
+		"vatRates": vatRates,
+	})
+}
+
+func (h *VatRateHandler) GetVatRateCreateForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "vat-rate-create-form.html", gin.H{})
+}
+
+func (h *VatRateHandler) CreateVatRate(c *gin.Context) {
+	var vatRate models.VatRate
+	if err := c.Bind(&vatRate); err != nil {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+	if err := bindValidity(c, &vatRate); err != nil {
+		c.String(http.StatusBadRequest, "Invalid date")
+		return
+	}
+	h.DB.Create(&vatRate)
+	c.HTML(http.StatusCreated, "vat-rate.html", vatRate)
+}
+
+func (h *VatRateHandler) GetVatRateEditForm(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var vatRate models.VatRate
+	if err := h.DB.First(&vatRate, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.HTML(http.StatusOK, "vat-rate-edit-form.html", gin.H{"vatRate": vatRate})
+}
+
+// UpdateVatRate corrects a rate in place. A changed percentage is a legal rate change: the rate is
+// closed the day before the new one starts and the new percentage is added as a rate with the same
+// code, so documents and items keep the percentage that applied on their dates.
+func (h *VatRateHandler) UpdateVatRate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var vatRate models.VatRate
+	if err := h.DB.First(&vatRate, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var updatedVatRate models.VatRate
+	if err := c.Bind(&updatedVatRate); err != nil {
+		c.String(http.StatusBadRequest, "Bad request")
+		return
+	}
+	if err := bindValidity(c, &updatedVatRate); err != nil {
+		c.String(http.StatusBadRequest, "Invalid date")
+		return
+	}
+
+	if updatedVatRate.Percent != vatRate.Percent {
+		h.changeVatRate(c, vatRate, updatedVatRate)
+		return
+	}
+
+	// Update fields while preserving ID
+	vatRate.Code = updatedVatRate.Code
+	vatRate.Name = updatedVatRate.Name
+	vatRate.Label = updatedVatRate.Label
+	vatRate.ValidFrom = updatedVatRate.ValidFrom
+	vatRate.ValidTo = updatedVatRate.ValidTo
+	vatRate.Exempt = updatedVatRate.Exempt
+
+	h.DB.Save(&vatRate)
+	c.HTML(http.StatusOK, "vat-rate.html", vatRate)
+}
+
+// changeVatRate closes the current rate and adds the new percentage valid from the entered date
+func (h *VatRateHandler) changeVatRate(c *gin.Context, current, changed models.VatRate) {
+	if changed.ValidFrom == nil || (current.ValidFrom != nil && !changed.ValidFrom.After(*current.ValidFrom)) {
+		c.String(http.StatusUnprocessableEntity, "Nova stopa mora imati datum početka važenja posle početka važenja postojeće")
+		return
+	}
+
+	changed.Code = current.Code
+	validTo := changed.ValidFrom.AddDate(0, 0, -1)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&current).Update("valid_to", validTo).Error; err != nil {
+			return err
+		}
+		return tx.Create(&changed).Error
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Both the closed and the new rate are shown, so the whole list is rendered again
+	vatRates, _ := models.LoadVatRates(h.DB)
+	c.Header("HX-Retarget", "#vatRatesTable")
+	c.Header("HX-Reswap", "outerHTML")
+	c.HTML(http.StatusOK, "vat_rates_list.html", gin.H{"vatRates": vatRates})
+}
+
+func (h *VatRateHandler) DeleteVatRate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var vatRate models.VatRate
+	if err := h.DB.First(&vatRate, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var used int64
+	h.DB.Model(&models.Item{}).Where("vat_rate_id = ?", vatRate.ID).Count(&used)
+	if used > 0 {
+		c.String(http.StatusConflict, "VAT rate is assigned to items")
+		return
+	}
+
+	h.DB.Delete(&vatRate)
+	c.String(http.StatusOK, "")
+}
+
+// bindValidity reads the optional validity period of a rate from the form
+func bindValidity(c *gin.Context, vatRate *models.VatRate) error {
+	vatRate.ValidFrom = nil
+	vatRate.ValidTo = nil
+	if v := c.PostForm("ValidFrom"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return err
+		}
+		vatRate.ValidFrom = &t
+	}
+	if v := c.PostForm("ValidTo"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return err
+		}
+		vatRate.ValidTo = &t
+	}
+	return nil
+}
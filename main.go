@@ -14,30 +14,47 @@ import (
 
 func main() {
 	populate := flag.Bool("populate", false, "Populate database from CSV file")
+	company := flag.Uint("company", 0, "Company whose items are populated, the first one by default")
 	flag.Parse()
 
 	db := initDb()
 
 	if *populate {
-		csv.Populate()
+		csv.Populate(*company)
 	}
 
 	r := gin.Default()
 
 	setupTemplates(r)
+	r.Use(handlers.Tenant(db))
 
 	companyHandler := handlers.NewCompanyHandler(db)
 	r.GET("/company", companyHandler.GetCompany)
 	r.POST("/company", companyHandler.UpsertCompany)
+	r.GET("/companies/switcher", companyHandler.GetCompanySwitcher)
+	r.POST("/companies/active", companyHandler.SelectCompany)
+	r.GET("/company/images/:kind", companyHandler.GetCompanyImage)
+	r.POST("/company/images/:kind", companyHandler.UploadCompanyImage)
+	r.DELETE("/company/images/:kind", companyHandler.DeleteCompanyImage)
+
+	locationHandler := handlers.NewLocationHandler(db)
+	r.GET("/locations", locationHandler.GetLocations)
+	r.POST("/locations", locationHandler.CreateLocation)
+	r.DELETE("/locations/:id", locationHandler.DeleteLocation)
+	r.GET("/locations/switcher", locationHandler.GetLocationSwitcher)
+	r.POST("/locations/active", locationHandler.SelectLocation)
 
 	itemHandler := handlers.NewItemHandler(db)
 	r.GET("/items", itemHandler.GetItems)
 	r.GET("/items/list", itemHandler.GetItemsPartial)
 	r.GET("/items/form", itemHandler.GetItemCreateForm)
 	r.POST("/items", itemHandler.CreateItem)
+	r.GET("/items/:id", itemHandler.GetItem)
 	r.GET("/items/:id/edit", itemHandler.GetItemEditForm)
 	r.PUT("/items/:id", itemHandler.UpdateItem)
 	r.DELETE("/items/:id", itemHandler.DeleteItem)
+	r.POST("/items/:id/archive", itemHandler.ArchiveItem)
+	r.POST("/items/:id/restore", itemHandler.RestoreItem)
 	r.GET("/items/export", itemHandler.ExportItems)
 	r.POST("/items/import", itemHandler.ImportItems)
 
@@ -49,17 +66,58 @@ func main() {
 	r.GET("/suppliers/:id/edit", supplierHandler.GetSupplierEditForm)
 	r.PUT("/suppliers/:id", supplierHandler.UpdateSupplier)
 	r.DELETE("/suppliers/:id", supplierHandler.DeleteSupplier)
+	r.POST("/suppliers/:id/archive", supplierHandler.ArchiveSupplier)
+	r.POST("/suppliers/:id/restore", supplierHandler.RestoreSupplier)
+	r.GET("/suppliers/:id", supplierHandler.GetSupplier)
+	r.GET("/suppliers/:id/ledger", supplierHandler.GetSupplierLedger)
+	r.POST("/suppliers/:id/items", supplierHandler.CreateSupplierItem)
+	r.GET("/suppliers/:id/items/:item_id", supplierHandler.GetSupplierItem)
+	r.GET("/suppliers/:id/items/:item_id/edit", supplierHandler.GetSupplierItemEditForm)
+	r.PUT("/suppliers/:id/items/:item_id", supplierHandler.UpdateSupplierItem)
+	r.DELETE("/suppliers/:id/items/:item_id", supplierHandler.DeleteSupplierItem)
+	r.POST("/suppliers/:id/accounts", supplierHandler.CreateSupplierBankAccount)
+	r.DELETE("/suppliers/:id/accounts/:account_id", supplierHandler.DeleteSupplierBankAccount)
+
+	vatRateHandler := handlers.NewVatRateHandler(db)
+	r.GET("/vat-rates", vatRateHandler.GetVatRates)
+	r.GET("/vat-rates/list", vatRateHandler.GetVatRatesPartial)
+	r.GET("/vat-rates/form", vatRateHandler.GetVatRateCreateForm)
+	r.POST("/vat-rates", vatRateHandler.CreateVatRate)
+	r.GET("/vat-rates/:id/edit", vatRateHandler.GetVatRateEditForm)
+	r.PUT("/vat-rates/:id", vatRateHandler.UpdateVatRate)
+	r.DELETE("/vat-rates/:id", vatRateHandler.DeleteVatRate)
 
 	invoiceHandler := handlers.NewInvoiceHandler(db)
 	r.GET("/invoices", invoiceHandler.GetInvoices)
 	r.POST("/invoices", invoiceHandler.InitializeInvoice)
+	r.POST("/invoices/einvoice", invoiceHandler.ImportEInvoice)
+	r.GET("/invoices/export", invoiceHandler.ExportInvoices)
 	r.POST("/invoices/:id/items", invoiceHandler.AddLineItem)
-	r.DELETE("/invoices/:id/items/:item_id", invoiceHandler.RemoveLineItem)
+	r.DELETE("/invoices/:id/items/:line_id", invoiceHandler.RemoveLineItem)
+	r.POST("/invoices/:id/items/:line_id/move", invoiceHandler.MoveLineItem)
+	r.POST("/invoices/:id/import", invoiceHandler.ImportLineItems)
+	r.POST("/invoices/:id/import-lines/:line_id", invoiceHandler.PairImportLine)
+	r.DELETE("/invoices/:id/import-lines/:line_id", invoiceHandler.RemoveImportLine)
 	r.POST("/invoices/:id/complete", invoiceHandler.CompleteInvoice)
+	r.GET("/invoices/:id/images/:kind", invoiceHandler.GetInvoiceImage)
 	r.GET("/invoices/:id/view", invoiceHandler.GetInvoiceDetails)
+	r.GET("/invoices/:id/pdf", invoiceHandler.GetInvoicePDF)
+	r.GET("/invoices/:id/clone", invoiceHandler.GetInvoiceCloneForm)
+	r.POST("/invoices/:id/clone", invoiceHandler.CloneInvoice)
 	r.GET("/invoices/:id/edit", invoiceHandler.GetInvoiceEditPage)
 	r.DELETE("/invoices/:id", invoiceHandler.DeleteInvoice)
 
+	paymentHandler := handlers.NewPaymentHandler(db)
+	r.GET("/payables", paymentHandler.GetPayables)
+	r.GET("/invoices/:id/payments", paymentHandler.GetInvoicePayments)
+	r.POST("/invoices/:id/payments", paymentHandler.CreatePayment)
+	r.DELETE("/invoices/:id/payments/:payment_id", paymentHandler.DeletePayment)
+	r.PUT("/invoices/:id/due-date", paymentHandler.UpdateDueDate)
+	r.GET("/payments/statement", paymentHandler.GetStatementReview)
+	r.POST("/payments/statement", paymentHandler.ImportStatement)
+	r.POST("/payments/transactions/:id/confirm", paymentHandler.ConfirmTransaction)
+	r.POST("/payments/transactions/:id/ignore", paymentHandler.IgnoreTransaction)
+
 	_ = r.Run(":8080")
 }
 
@@ -68,7 +126,9 @@ func initDb() *gorm.DB {
 	if err != nil {
 		panic("failed to connect database")
 	}
-	_ = db.AutoMigrate(&models.Company{}, &models.Item{}, &models.Supplier{}, &models.InvoiceItem{}, &models.Invoice{})
+	if err := models.Migrate(db); err != nil {
+		panic("failed to migrate database: " + err.Error())
+	}
 	return db
 }
 
@@ -0,0 +1,24 @@
+package models
+
+import "gorm.io/gorm"
+
+// Active limits a query on suppliers or items to those that are not archived
+func Active(db *gorm.DB) *gorm.DB {
+	return db.Where("archived = ?", false)
+}
+
+// SupplierHasDocuments reports whether any invoice was issued by the supplier
+func SupplierHasDocuments(db *gorm.DB, supplierID uint) (bool, error) {
+	var count int64
+	err := db.Model(&Invoice{}).Where("supplier_id = ?", supplierID).Count(&count).Error
+	return count > 0, err
+}
+
+// ItemHasDocuments reports whether the item appears on any invoice line
+func ItemHasDocuments(db *gorm.DB, itemID uint) (bool, error) {
+	var count int64
+	err := db.Model(&InvoiceItem{}).
+		Joins("JOIN invoices ON invoices.id = invoice_items.invoice_id AND invoices.deleted_at IS NULL").
+		Where("invoice_items.item_id = ?", itemID).Count(&count).Error
+	return count > 0, err
+}
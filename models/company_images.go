@@ -0,0 +1,66 @@
+package models
+
+import "gorm.io/gorm"
+
+// Kinds of company images printed on documents
+const (
+	ImageLogo      = "logo"
+	ImageStamp     = "stamp"
+	ImageSignature = "signature"
+)
+
+// Sides of the page an image is printed on. The logo goes to a corner of the header, the stamp
+// and signature to the signature line of the person who compiled the document (left) or of the
+// responsible person (right).
+const (
+	PositionLeft  = "left"
+	PositionRight = "right"
+)
+
+// CompanyImage is a logo, scanned stamp or signature of a company printed on its documents
+type CompanyImage struct {
+	gorm.Model
+	CompanyID   uint    `gorm:"not null;uniqueIndex:idx_company_image" json:"company_id"`
+	Kind        string  `gorm:"size:16;not null;uniqueIndex:idx_company_image" json:"kind"`
+	ContentType string  `gorm:"size:64" json:"content_type"`
+	Data        []byte  `json:"-"`
+	Position    string  `gorm:"size:16" json:"position"`
+	Height      float64 `json:"height"` // Printed height in millimetres
+}
+
+// ImageKind describes an image that can be uploaded and where it is printed until configured
+type ImageKind struct {
+	Kind     string
+	Label    string
+	Position string
+	Height   float64
+}
+
+var ImageKinds = []ImageKind{
+	{Kind: ImageLogo, Label: "Logo", Position: PositionLeft, Height: 15},
+	{Kind: ImageStamp, Label: "Pečat", Position: PositionRight, Height: 30},
+	{Kind: ImageSignature, Label: "Potpis", Position: PositionRight, Height: 12},
+}
+
+// ImageKindByName returns the description of an image kind
+func ImageKindByName(kind string) (ImageKind, bool) {
+	for _, k := range ImageKinds {
+		if k.Kind == kind {
+			return k, true
+		}
+	}
+	return ImageKind{}, false
+}
+
+// CompanyImages loads the images of a company by kind
+func CompanyImages(db *gorm.DB, companyID uint) (map[string]CompanyImage, error) {
+	var images []CompanyImage
+	if err := db.Where("company_id = ?", companyID).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	byKind := make(map[string]CompanyImage, len(images))
+	for _, image := range images {
+		byKind[image.Kind] = image
+	}
+	return byKind, nil
+}
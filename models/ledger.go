@@ -0,0 +1,119 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LedgerEntry is one booking on a supplier ledger card (kartica dobavljača). Invoices are
+// credited to the supplier's account, payments and returns are debited.
+type LedgerEntry struct {
+	Date        time.Time
+	Document    string
+	Description string
+	Debit       float64
+	Credit      float64
+	Balance     float64 // Amount owed to the supplier after this booking
+	InvoiceID   uint
+}
+
+// SupplierLedger holds the bookings of one supplier within a period
+type SupplierLedger struct {
+	Supplier Supplier
+	From     time.Time
+	To       time.Time
+	Opening  float64
+	Entries  []LedgerEntry
+	Debit    float64
+	Credit   float64
+	Closing  float64
+}
+
+// BuildSupplierLedger collects completed invoices and payments of a supplier up to the end of
+// the period, limited to one location unless locationID is 0. Everything booked before the start
+// is summed into the opening balance. Returned goods are entered as lines with a negative
+// quantity, an invoice whose total is negative is booked as a return.
+func BuildSupplierLedger(db *gorm.DB, supplier Supplier, locationID uint, from, to time.Time) (SupplierLedger, error) {
+	ledger := SupplierLedger{Supplier: supplier, From: from, To: to}
+	end := to.AddDate(0, 0, 1)
+	inLocation := func(query *gorm.DB) *gorm.DB {
+		if locationID == 0 {
+			return query
+		}
+		return query.Where("invoices.location_id = ?", locationID)
+	}
+
+	var invoices []Invoice
+	err := db.Scopes(inLocation).Where("supplier_id = ? AND completed_at IS NOT NULL AND date < ?", supplier.ID, end).
+		Order("date, id").Find(&invoices).Error
+	if err != nil {
+		return ledger, err
+	}
+
+	// A payment may precede its invoice in the ledger, so the document number is joined in
+	var payments []struct {
+		Payment
+		DocumentNumber string
+	}
+	err = db.Model(&Payment{}).Scopes(inLocation).Select("payments.*, invoices.document_number").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id AND invoices.deleted_at IS NULL").
+		Where("invoices.supplier_id = ? AND payments.date < ?", supplier.ID, end).
+		Order("payments.date, payments.id").Scan(&payments).Error
+	if err != nil {
+		return ledger, err
+	}
+
+	var entries []LedgerEntry
+	for _, invoice := range invoices {
+		entry := LedgerEntry{Date: invoice.Date, Document: invoice.DocumentNumber, InvoiceID: invoice.ID}
+		if invoice.SupplierTotal < 0 {
+			entry.Description = "Povraćaj robe"
+			entry.Debit = -invoice.SupplierTotal
+		} else {
+			entry.Description = "Faktura"
+			entry.Credit = invoice.SupplierTotal
+		}
+		if invoice.InternalNumber != "" {
+			entry.Description += " (" + invoice.InternalNumber + ")"
+		}
+		entries = append(entries, entry)
+	}
+	for _, payment := range payments {
+		description := "Plaćanje"
+		if payment.Method != "" {
+			description += " - " + payment.Method
+		}
+		if payment.Reference != "" {
+			description += " " + payment.Reference
+		}
+		entries = append(entries, LedgerEntry{
+			Date:        payment.Date,
+			Document:    payment.DocumentNumber,
+			Description: description,
+			Debit:       payment.Amount,
+			InvoiceID:   payment.InvoiceID,
+		})
+	}
+
+	// Invoices were added before payments, so a payment made on the invoice date follows it
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	balance := 0.0
+	for _, entry := range entries {
+		balance += entry.Credit - entry.Debit
+		if entry.Date.Before(from) {
+			ledger.Opening = balance
+			continue
+		}
+		entry.Balance = balance
+		ledger.Debit += entry.Debit
+		ledger.Credit += entry.Credit
+		ledger.Entries = append(ledger.Entries, entry)
+	}
+	ledger.Closing = balance
+	return ledger, nil
+}
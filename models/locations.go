@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Location is a shop (prodavnica) of a company. Kalkulacije are kept per location.
+type Location struct {
+	gorm.Model
+	CompanyID uint   `gorm:"index" form:"-" json:"company_id"`
+	Name      string `gorm:"not null" json:"name"`
+	Code      string `json:"code"` // Oznaka poslovne jedinice
+	Address   string `json:"address"`
+}
+
+// AssignUnlocatedInvoices gives invoices entered before their company had locations to the first
+// location of the company, so that filtering by location does not hide them
+func AssignUnlocatedInvoices(db *gorm.DB) error {
+	return db.Exec(`UPDATE invoices SET location_id = (
+		SELECT MIN(id) FROM locations WHERE locations.company_id = invoices.company_id AND locations.deleted_at IS NULL)
+		WHERE location_id IS NULL AND EXISTS (
+		SELECT 1 FROM locations WHERE locations.company_id = invoices.company_id AND locations.deleted_at IS NULL)`).Error
+}
+
+// LocationHasDocuments reports whether any invoice was entered for the location
+func LocationHasDocuments(db *gorm.DB, locationID uint) (bool, error) {
+	var count int64
+	err := db.Model(&Invoice{}).Where("location_id = ?", locationID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,356 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migrate brings the database schema up to date and fills in data for newly added columns
+func Migrate(db *gorm.DB) error {
+	if err := rebuildInvoiceItems(db); err != nil {
+		return err
+	}
+	if err := rebuildDocumentSequences(db); err != nil {
+		return err
+	}
+	// Internal numbers used to be indexed without enforcing uniqueness
+	if err := dropIndexUnlessUnique(db, "invoices", "idx_invoice_sequence"); err != nil {
+		return err
+	}
+
+	// The supplier code used to hold the PIB until the PIB got a column of its own
+	copyPIB := db.Migrator().HasTable(&Supplier{}) && !db.Migrator().HasColumn(&Supplier{}, "PIB")
+	// Invoices posted before the images were part of the snapshot keep the images of that time
+	freezeImages := db.Migrator().HasTable(&Invoice{}) && !db.Migrator().HasTable(&PostedImage{})
+
+	if err := db.AutoMigrate(&Company{}, &Item{}, &Supplier{}, &InvoiceItem{}, &Invoice{}, &SupplierItem{}, &ImportLine{}, &ItemPrice{}, &VatRate{}, &DocumentSequence{}, &SupplierBankAccount{}, &Payment{}, &BankTransaction{}, &Location{}, &CompanyImage{}, &ImageVersion{}, &PostedImage{}); err != nil {
+		return err
+	}
+
+	if err := seedVatRates(db); err != nil {
+		return err
+	}
+	if copyPIB {
+		if err := copySupplierPIBs(db); err != nil {
+			return err
+		}
+	}
+	if freezeImages {
+		if err := freezePostedImages(db); err != nil {
+			return err
+		}
+	}
+
+	// Data entered while there was a single company belongs to the first one
+	var first Company
+	if err := db.Order("id").Limit(1).Find(&first).Error; err != nil {
+		return err
+	}
+	if first.ID != 0 {
+		if err := AssignOrphans(db, first.ID); err != nil {
+			return err
+		}
+	}
+	if err := AssignUnlocatedInvoices(db); err != nil {
+		return err
+	}
+
+	// Companies created before the flag existed were treated as VAT payers
+	if err := db.Model(&Company{}).Where("vat_payer IS NULL").Update("vat_payer", true).Error; err != nil {
+		return err
+	}
+
+	// Items and lines created before the rate table reference the rate matching their percentage
+	// Items no longer store the percentage, databases created since then have nothing to backfill
+	for _, table := range []string{"items", "invoice_items"} {
+		if !db.Migrator().HasColumn(table, "tax_rate") {
+			continue
+		}
+		err := db.Exec(`UPDATE ` + table + ` SET vat_rate_id = (
+			SELECT id FROM vat_rates WHERE vat_rates.percent = ` + table + `.tax_rate AND vat_rates.deleted_at IS NULL ORDER BY id LIMIT 1)
+			WHERE vat_rate_id IS NULL OR vat_rate_id = 0`).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.Exec(`UPDATE invoice_items SET tax_label = (SELECT label FROM vat_rates WHERE vat_rates.id = invoice_items.vat_rate_id)
+		WHERE tax_label IS NULL OR tax_label = ''`).Error; err != nil {
+		return err
+	}
+
+	// Lines entered before the supplier price was stored only kept the discounted price
+	if err := db.Model(&InvoiceItem{}).Where("(price IS NULL OR price = 0) AND discount < 100").Update("price", gorm.Expr("buying_price * 100 / (100 - discount)")).Error; err != nil {
+		return err
+	}
+
+	// Lines entered before they had a position keep the order in which they were entered
+	if err := db.Exec(`UPDATE invoice_items SET position = (
+		SELECT COUNT(*) FROM invoice_items AS other WHERE other.invoice_id = invoice_items.invoice_id AND other.id <= invoice_items.id)
+		WHERE invoice_id IN (SELECT invoice_id FROM invoice_items WHERE position IS NULL OR position = 0)`).Error; err != nil {
+		return err
+	}
+
+	// Invoices completed before the completion time was stored are recognised by their totals
+	if err := db.Model(&Invoice{}).Where("completed_at IS NULL AND total <> 0").Update("completed_at", gorm.Expr("updated_at")).Error; err != nil {
+		return err
+	}
+
+	if err := db.Model(&Company{}).Where("number_format IS NULL OR number_format = ''").Update("number_format", DefaultNumberFormat).Error; err != nil {
+		return err
+	}
+	if err := numberCompletedInvoices(db); err != nil {
+		return err
+	}
+
+	// Completed invoices from before payment tracking owe the supplier value of their lines
+	if err := db.Exec(`UPDATE invoices SET supplier_total = (
+		SELECT COALESCE(SUM(price * (1 - discount / 100) * quantity * (1 + tax_rate / 100)), 0) FROM invoice_items WHERE invoice_items.invoice_id = invoices.id)
+		WHERE completed_at IS NOT NULL AND (supplier_total IS NULL OR supplier_total = 0)`).Error; err != nil {
+		return err
+	}
+	if err := fillDueDates(db); err != nil {
+		return err
+	}
+	if err := snapshotPostedInvoices(db); err != nil {
+		return err
+	}
+
+	// Suppliers and items deleted while documents still referred to them come back archived
+	if err := db.Exec(`UPDATE suppliers SET deleted_at = NULL, archived = true
+		WHERE deleted_at IS NOT NULL AND id IN (SELECT supplier_id FROM invoices WHERE deleted_at IS NULL)`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`UPDATE items SET deleted_at = NULL, archived = true
+		WHERE deleted_at IS NOT NULL AND id IN (SELECT item_id FROM invoice_items
+			JOIN invoices ON invoices.id = invoice_items.invoice_id AND invoices.deleted_at IS NULL)`).Error; err != nil {
+		return err
+	}
+
+	// Items created before prices were versioned start their history with the current price
+	if err := db.Exec(`INSERT INTO item_prices (created_at, updated_at, item_id, price, valid_from, source)
+		SELECT created_at, created_at, id, price, created_at, ? FROM items
+		WHERE deleted_at IS NULL AND id NOT IN (SELECT item_id FROM item_prices WHERE deleted_at IS NULL)`, PriceSourceManual).Error; err != nil {
+		return err
+	}
+	return truncatePriceDays(db)
+}
+
+// truncatePriceDays moves prices recorded with a time of day to the start of their day
+func truncatePriceDays(db *gorm.DB) error {
+	var prices []ItemPrice
+	if err := db.Unscoped().Find(&prices).Error; err != nil {
+		return err
+	}
+	for _, price := range prices {
+		day := PriceDay(price.ValidFrom)
+		if price.ValidFrom.Equal(day) && price.ValidFrom.Location() == time.UTC {
+			continue
+		}
+		if err := db.Unscoped().Model(&price).UpdateColumn("valid_from", day).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// numberCompletedInvoices assigns internal numbers to invoices completed before numbering existed,
+// in the order of their dates
+func numberCompletedInvoices(db *gorm.DB) error {
+	companies, err := companiesByID(db)
+	if err != nil {
+		return err
+	}
+
+	var invoices []Invoice
+	if err := db.Where("completed_at IS NOT NULL AND (sequence IS NULL OR sequence = 0)").Order("date, id").Find(&invoices).Error; err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		format := companies[invoice.CompanyID].NumberFormat
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := AssignInternalNumber(tx, &invoice, format); err != nil {
+				return err
+			}
+			return tx.Model(&invoice).Select("fiscal_year", "sequence", "internal_number").Updates(&invoice).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildInvoiceItems recreates invoice lines stored before they had their own primary key.
+// SQLite cannot add a primary key to an existing table, so the lines are copied in their original order.
+func rebuildInvoiceItems(db *gorm.DB) error {
+	if !db.Migrator().HasTable("invoice_items") {
+		return nil
+	}
+	// HasColumn would match the id of the foreign key reference, so inspect the actual columns
+	existing, err := db.Migrator().ColumnTypes("invoice_items")
+	if err != nil {
+		return err
+	}
+	for _, column := range existing {
+		if column.Name() == "id" {
+			return nil
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE invoice_items RENAME TO invoice_items_old").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_invoice_item").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateTable(&InvoiceItem{}); err != nil {
+			return err
+		}
+
+		oldColumns, err := tx.Migrator().ColumnTypes("invoice_items_old")
+		if err != nil {
+			return err
+		}
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(&InvoiceItem{}); err != nil {
+			return err
+		}
+		var columns []string
+		for _, column := range oldColumns {
+			if _, ok := stmt.Schema.FieldsByDBName[column.Name()]; ok {
+				columns = append(columns, "`"+column.Name()+"`")
+			}
+		}
+		list := strings.Join(columns, ", ")
+		if err := tx.Exec("INSERT INTO invoice_items (" + list + ") SELECT " + list + " FROM invoice_items_old ORDER BY rowid").Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE invoice_items_old").Error
+	})
+}
+
+// rebuildDocumentSequences adds the company to the key of the numbering sequences.
+// SQLite cannot change a primary key, so the table is recreated.
+func rebuildDocumentSequences(db *gorm.DB) error {
+	if !db.Migrator().HasTable("document_sequences") {
+		return nil
+	}
+	existing, err := db.Migrator().ColumnTypes("document_sequences")
+	if err != nil {
+		return err
+	}
+	for _, column := range existing {
+		if column.Name() == "company_id" {
+			return nil
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE document_sequences RENAME TO document_sequences_old").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateTable(&DocumentSequence{}); err != nil {
+			return err
+		}
+		// Filled in with the first company once it is known
+		if err := tx.Exec("INSERT INTO document_sequences (company_id, year, last) SELECT 0, year, last FROM document_sequences_old").Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE document_sequences_old").Error
+	})
+}
+
+// copySupplierPIBs fills the new PIB columns of suppliers and posted invoices with the codes that
+// look like a PIB. The code itself is kept as the supplier code.
+// freezePostedImages snapshots the current company images on every invoice posted with a snapshot
+func freezePostedImages(db *gorm.DB) error {
+	var invoices []Invoice
+	if err := db.Select("id", "company_id").Where("posted_company_name <> '' OR posted_supplier_name <> ''").Find(&invoices).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, invoice := range invoices {
+			if err := SnapshotImages(tx, invoice.ID, invoice.CompanyID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func copySupplierPIBs(db *gorm.DB) error {
+	const looksLikePIB = ` GLOB '[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]'`
+	if err := db.Exec(`UPDATE suppliers SET pib = TRIM(code) WHERE TRIM(code)` + looksLikePIB).Error; err != nil {
+		return err
+	}
+	return db.Exec(`UPDATE invoices SET posted_supplier_pib = TRIM(posted_supplier_code) WHERE TRIM(posted_supplier_code)` + looksLikePIB).Error
+}
+
+// dropIndexUnlessUnique drops an index that AutoMigrate has to recreate as a unique one
+func dropIndexUnlessUnique(db *gorm.DB, table, name string) error {
+	var unique []bool
+	if err := db.Raw(`SELECT "unique" FROM pragma_index_list(?) WHERE name = ?`, table, name).Scan(&unique).Error; err != nil {
+		return err
+	}
+	if len(unique) == 0 || unique[0] {
+		return nil
+	}
+	return db.Exec("DROP INDEX " + name).Error
+}
+
+// companiesByID loads all companies keyed by their ID
+func companiesByID(db *gorm.DB) (map[uint]Company, error) {
+	var companies []Company
+	if err := db.Find(&companies).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Company, len(companies))
+	for _, company := range companies {
+		byID[company.ID] = company
+	}
+	return byID, nil
+}
+
+// fillDueDates sets the due date of invoices entered before due dates existed from the supplier's payment term
+func fillDueDates(db *gorm.DB) error {
+	var invoices []Invoice
+	if err := db.Where("due_date IS NULL").Find(&invoices).Error; err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		dueDate := DefaultDueDate(db, invoice.SupplierID, invoice.Date)
+		if err := db.Model(&invoice).Update("due_date", dueDate).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotPostedInvoices freezes the current company and supplier data on invoices posted
+// before snapshots were taken, which is the closest record of what they were printed with
+func snapshotPostedInvoices(db *gorm.DB) error {
+	var invoices []Invoice
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	err := db.Preload("Supplier", unscoped).Preload("Location", unscoped).
+		Where("completed_at IS NOT NULL AND COALESCE(posted_company_name, '') = '' AND COALESCE(posted_supplier_name, '') = ''").
+		Find(&invoices).Error
+	if err != nil || len(invoices) == 0 {
+		return err
+	}
+
+	companies, err := companiesByID(db)
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		invoice.TakeSnapshot(companies[invoice.CompanyID], invoice.Supplier)
+		if err := db.Omit(clause.Associations).Save(&invoice).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
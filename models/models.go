@@ -1,6 +1,11 @@
 package models
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,51 +13,220 @@ import (
 
 type Item struct {
 	gorm.Model
-	ID      uint    `gorm:"primaryKey" json:"ID"`
-	Name    string  `json:"name"`
-	Price   float64 `json:"price"`
-	TaxRate int     `gorm:"default:0" json:"taxRate"`
-	Unit    string  `json:"unit"`
+	ID        uint    `gorm:"primaryKey" json:"ID"`
+	CompanyID uint    `gorm:"index" form:"-" json:"company_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	VatRateID uint    `gorm:"index" json:"vat_rate_id"`
+	VatRate   VatRate `gorm:"foreignKey:VatRateID" json:"vat_rate"`
+	Unit      string  `json:"unit"`
+	// Archived items are kept for the documents using them but are no longer offered for new ones
+	Archived bool `gorm:"index;default:false" form:"-" json:"archived"`
+}
+
+// TaxPercent returns the VAT percentage of the item's rate, the rate has to be loaded
+func (i Item) TaxPercent() float64 {
+	return i.VatRate.Percent
+}
+
+// VatRate is a VAT rate with the register letter printed by fiscal devices.
+// A rate change is entered as a new rate with the same code and a later validity period.
+type VatRate struct {
+	gorm.Model
+	Code      string     `gorm:"size:32;not null;index" json:"code"`
+	Name      string     `json:"name"`
+	Percent   float64    `json:"percent"`
+	Label     string     `gorm:"size:8" json:"label"` // Register letter: Ђ, Е, А, Г...
+	ValidFrom *time.Time `form:"-" json:"valid_from"`
+	ValidTo   *time.Time `form:"-" json:"valid_to"`
+	Exempt    bool       `json:"exempt"` // 0% rate or goods outside the VAT system
+}
+
+// ValidAt reports whether the rate applies on the given date, both ends of the period included
+func (r VatRate) ValidAt(t time.Time) bool {
+	return (r.ValidFrom == nil || !t.Before(*r.ValidFrom)) && (r.ValidTo == nil || t.Before(r.ValidTo.AddDate(0, 0, 1)))
 }
 
 type Company struct {
 	gorm.Model
-	Code       string `gorm:"size:255;not null" json:"code"`
-	SectorCode string `gorm:"size:255;not null" json:"sector_code"`
-	Sector     string `gorm:"size:255;not null" json:"sector"`
-	Name       string `gorm:"size:255;not null" json:"name"`
-	Address    string `gorm:"size:255" json:"address"`
-	Owner      string `gorm:"size:255" json:"owner"`
-	User       string `gorm:"size:255" json:"user"`
+	Code string `gorm:"size:255;not null" json:"code"` // PIB
+	// Matični broj
+	RegistrationNumber string `gorm:"size:8" json:"registration_number"`
+	SectorCode         string `gorm:"size:255;not null" json:"sector_code"`
+	Sector             string `gorm:"size:255;not null" json:"sector"`
+	Name               string `gorm:"size:255;not null" json:"name"`
+	Address            string `gorm:"size:255" json:"address"`
+	Owner              string `gorm:"size:255" json:"owner"`
+	User               string `gorm:"size:255" json:"user"`
+	// Warn when a purchase price deviates from the supplier's last price by more than this percentage,
+	// 0 turns the warning off
+	PriceDeviationPercent float64 `json:"price_deviation_percent"`
+	// Businesses outside the VAT system carry the supplier's VAT as cost and do not split VAT on sale
+	VatPayer bool `json:"vat_payer"`
+	// Format of the internal kalkulacija number, see FormatNumber
+	NumberFormat string `gorm:"size:64" json:"number_format"`
 }
 
+// DefaultPriceDeviationPercent is the price deviation threshold offered for a new company
+const DefaultPriceDeviationPercent = 10
+
 type Supplier struct {
 	gorm.Model
-	ID      uint   `gorm:"primaryKey" json:"ID"`
-	Name    string `json:"name"`
-	Code    string `json:"code"`
-	Address string `json:"address"`
+	ID        uint   `gorm:"primaryKey" json:"ID"`
+	CompanyID uint   `gorm:"index" form:"-" json:"company_id"`
+	Name      string `json:"name"`
+	Code      string `json:"code"` // Šifra dobavljača
+	PIB       string `gorm:"index" json:"pib"`
+	Address   string `json:"address"`
+	// Matični broj
+	RegistrationNumber string                `json:"registration_number"`
+	PostalCode         string                `json:"postal_code"`
+	City               string                `json:"city"`
+	ContactPerson      string                `json:"contact_person"`
+	Phone              string                `json:"phone"`
+	Email              string                `json:"email"`
+	PaymentTermDays    int                   `json:"payment_term_days"` // Default number of days until an invoice is due
+	BankAccounts       []SupplierBankAccount `gorm:"foreignKey:SupplierID" form:"-" json:"bank_accounts"`
+	// Archived suppliers are kept for their documents but cannot be picked for new invoices
+	Archived bool `gorm:"index;default:false" form:"-" json:"archived"`
+}
+
+// FullAddress returns the street address followed by postal code and city
+func (s Supplier) FullAddress() string {
+	city := strings.TrimSpace(s.PostalCode + " " + s.City)
+	if city == "" {
+		return s.Address
+	}
+	if s.Address == "" {
+		return city
+	}
+	return s.Address + ", " + city
+}
+
+// SupplierBankAccount is one of the supplier's current accounts, stored as 18 digits
+type SupplierBankAccount struct {
+	gorm.Model
+	SupplierID uint   `gorm:"not null;index" json:"supplier_id"`
+	Number     string `gorm:"size:18;not null" json:"number"`
+	Bank       string `json:"bank"`
+}
+
+// Formatted returns the account number in the usual 3-13-2 notation
+func (a SupplierBankAccount) Formatted() string {
+	return FormatBankAccount(a.Number)
 }
 
 type Invoice struct {
 	gorm.Model
 	ID             uint          `gorm:"primaryKey" json:"id"`
+	CompanyID      uint          `gorm:"index;uniqueIndex:idx_invoice_sequence,priority:1,where:sequence <> 0" form:"-" json:"company_id"`
 	SupplierID     uint          `gorm:"not null" json:"supplier_id"`
 	Supplier       Supplier      `gorm:"foreignKey:SupplierID" json:"supplier"`
+	LocationID     *uint         `gorm:"index" json:"location_id"` // Shop the goods were received in, none for a single shop
+	Location       *Location     `gorm:"foreignKey:LocationID" form:"-" json:"location"`
 	LineItems      []InvoiceItem `gorm:"foreignKey:InvoiceID" json:"line_items"`
 	Subtotal       float64       `json:"subtotal"`
 	TaxAmount      float64       `json:"tax_amount"`
 	Total          float64       `json:"total"`
 	Date           time.Time     `json:"date"`
 	DocumentNumber string        `json:"document_number"`
+	// Set when the kalkulacija is completed, drafts have no completion time
+	CompletedAt *time.Time `json:"completed_at"`
+	// Internal number assigned on completion, sequential within the fiscal year of the company
+	FiscalYear     int    `gorm:"uniqueIndex:idx_invoice_sequence,priority:2" json:"fiscal_year"`
+	Sequence       int    `gorm:"uniqueIndex:idx_invoice_sequence,priority:3" json:"sequence"`
+	InternalNumber string `json:"internal_number"`
+	// Amount owed to the supplier including VAT, set on completion
+	SupplierTotal float64    `json:"supplier_total"`
+	DueDate       *time.Time `json:"due_date"`
+	Payments      []Payment  `gorm:"foreignKey:InvoiceID" json:"payments"`
+	// Another invoice with the same supplier, document number and year, filled in for listings
+	DuplicateOf uint `gorm:"-" json:"-"`
+	// Company header and supplier details as they were when the invoice was posted
+	PostedCompany  CompanySnapshot  `gorm:"embedded;embeddedPrefix:posted_company_" form:"-" json:"posted_company"`
+	PostedSupplier SupplierSnapshot `gorm:"embedded;embeddedPrefix:posted_supplier_" form:"-" json:"posted_supplier"`
+}
+
+// DuplicateKey identifies a supplier document: the same number may be reused by a supplier in another year
+func (i Invoice) DuplicateKey() string {
+	return fmt.Sprintf("%d|%d|%s", i.SupplierID, i.Date.Year(), strings.ToLower(strings.TrimSpace(i.DocumentNumber)))
 }
 
+// Completed reports whether the kalkulacija has been completed
+func (i Invoice) Completed() bool {
+	return i.CompletedAt != nil
+}
+
+// Posted reports whether the kalkulacija is in the book, its lines can no longer change
+func (i Invoice) Posted() bool {
+	return i.CompletedAt != nil || i.Sequence != 0
+}
+
+// SellingValue returns the selling value of the invoice without VAT
+func (i Invoice) SellingValue() float64 {
+	return i.Total - i.TaxAmount
+}
+
+// Margin returns the difference between the selling value without VAT and the purchase value
+func (i Invoice) Margin() float64 {
+	return i.SellingValue() - i.Subtotal
+}
+
+// VatRecap holds the invoice totals of a single VAT rate
+type VatRecap struct {
+	TaxLabel      string
+	TaxRate       float64
+	PurchaseValue float64
+	Margin        float64
+	Base          float64 // Selling value without VAT
+	TaxAmount     float64
+	Total         float64
+}
+
+// Recapitulation sums the invoice lines per VAT rate, highest rate first
+func (i Invoice) Recapitulation() []VatRecap {
+	var recap []VatRecap
+	for _, line := range i.LineItems {
+		idx := -1
+		for j := range recap {
+			if recap[j].TaxRate == line.TaxRate && recap[j].TaxLabel == line.TaxLabel {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			recap = append(recap, VatRecap{TaxLabel: line.TaxLabel, TaxRate: line.TaxRate})
+			idx = len(recap) - 1
+		}
+		recap[idx].PurchaseValue += line.Subtotal
+		recap[idx].Margin += line.Margin()
+		recap[idx].Base += line.SellingValue()
+		recap[idx].TaxAmount += line.TaxAmount
+		recap[idx].Total += line.Total
+	}
+
+	sort.Slice(recap, func(a, b int) bool {
+		if recap[a].TaxRate != recap[b].TaxRate {
+			return recap[a].TaxRate > recap[b].TaxRate
+		}
+		return recap[a].TaxLabel < recap[b].TaxLabel
+	})
+	return recap
+}
+
+// InvoiceItem is a line of a kalkulacija. The same item may appear on several lines,
+// e.g. at two prices or as a free bonus line.
 type InvoiceItem struct {
-	InvoiceID    uint    `json:"invoice_id" gorm:"uniqueIndex:idx_invoice_item"` // Part of unique constraint
-	ItemID       uint    `json:"item_id" gorm:"uniqueIndex:idx_invoice_item"`    // Part of unique constraint
+	ID           uint    `gorm:"primaryKey" json:"id"`
+	InvoiceID    uint    `json:"invoice_id" gorm:"index"`
+	ItemID       uint    `json:"item_id" gorm:"index"`
+	Position     int     `json:"position"` // Order of the line on the supplier document
 	Name         string  `json:"name"`
 	Unit         string  `json:"unit"`
+	VatRateID    uint    `json:"vat_rate_id"`
+	TaxLabel     string  `json:"tax_label"`
 	TaxRate      float64 `json:"tax_rate"`
+	Price        float64 `json:"price"` // Supplier price before discount
 	Discount     float64 `json:"discount"`
 	Quantity     float64 `json:"quantity"`
 	BuyingPrice  float64 `json:"buying_price"`
@@ -62,3 +236,69 @@ type InvoiceItem struct {
 	Total        float64 `json:"total"`
 	Note         string  `json:"note"`
 }
+
+// SellingValue returns the selling value of the line without VAT
+func (ii InvoiceItem) SellingValue() float64 {
+	return ii.Total - ii.TaxAmount
+}
+
+// Margin returns the difference between the selling value without VAT and the purchase value
+func (ii InvoiceItem) Margin() float64 {
+	return ii.SellingValue() - ii.Subtotal
+}
+
+// SupplierItem remembers which of our items a supplier's article code refers to,
+// together with the terms of the last purchase
+type SupplierItem struct {
+	gorm.Model
+	SupplierID   uint       `gorm:"not null;index:idx_supplier_item_code" json:"supplier_id"`
+	SupplierCode string     `gorm:"index:idx_supplier_item_code" json:"supplier_code"`
+	SupplierName string     `json:"supplier_name"`
+	ItemID       uint       `gorm:"not null;index" json:"item_id"`
+	Item         Item       `gorm:"foreignKey:ItemID" json:"item"`
+	LastPrice    float64    `json:"last_price"`
+	LastDiscount float64    `json:"last_discount"`
+	LastDate     *time.Time `json:"last_date"`
+}
+
+// ImportLine is an imported supplier line still waiting to be paired with an item
+type ImportLine struct {
+	gorm.Model
+	InvoiceID    uint    `gorm:"not null;index" json:"invoice_id"`
+	SupplierCode string  `json:"supplier_code"`
+	Name         string  `json:"name"`
+	Quantity     float64 `json:"quantity"`
+	Price        float64 `json:"price"`
+	Discount     float64 `json:"discount"`
+	TaxCategory  string  `json:"tax_category"`
+	TaxRate      float64 `json:"tax_rate"`
+	// Position the line gets on the invoice once paired, keeping the supplier document order
+	Position int `json:"position"`
+	// Why the line was not paired with the item it was mapped or paired to
+	Warning string `json:"warning"`
+}
+
+// VatWarning describes a difference between the VAT rate on the supplier's e-invoice and the
+// rate of the item the line is paired with. Lines read from CSV files carry no rate.
+func (l ImportLine) VatWarning(item Item) string {
+	if l.TaxCategory == "" || math.Abs(l.TaxRate-item.TaxPercent()) < 0.005 {
+		return ""
+	}
+	return fmt.Sprintf("PDV dobavljača %s%% ne odgovara stopi proizvoda %s (%s%%)",
+		strconv.FormatFloat(l.TaxRate, 'f', -1, 64), item.Name, strconv.FormatFloat(item.TaxPercent(), 'f', -1, 64))
+}
+
+const (
+	PriceSourceManual      = "manual"
+	PriceSourceKalkulacija = "kalkulacija"
+	PriceSourceImport      = "import"
+)
+
+// ItemPrice is a selling price of an item, valid from ValidFrom until the next price of the same item
+type ItemPrice struct {
+	gorm.Model
+	ItemID    uint      `gorm:"not null;index:idx_item_price_valid" json:"item_id"`
+	Price     float64   `json:"price"`
+	ValidFrom time.Time `gorm:"index:idx_item_price_valid" json:"valid_from"`
+	Source    string    `gorm:"size:32" json:"source"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DefaultNumberFormat produces internal numbers such as K-0045/2026
+const DefaultNumberFormat = "K-{NNNN}/{YYYY}"
+
+// DocumentSequence holds the last internal number a company issued in a fiscal year
+type DocumentSequence struct {
+	CompanyID uint `gorm:"primaryKey;autoIncrement:false" json:"company_id"`
+	Year      int  `gorm:"primaryKey;autoIncrement:false" json:"year"`
+	Last      int  `gorm:"not null" json:"last"`
+}
+
+var sequenceToken = regexp.MustCompile(`\{N+\}`)
+
+// ValidNumberFormat reports whether the format contains the sequence token
+func ValidNumberFormat(format string) bool {
+	return sequenceToken.MatchString(format)
+}
+
+// FormatNumber fills the format's tokens: {N...} is the sequence padded to the number of N's,
+// {YYYY} and {YY} are the fiscal year.
+func FormatNumber(format string, year, sequence int) string {
+	if format == "" {
+		format = DefaultNumberFormat
+	}
+	number := sequenceToken.ReplaceAllStringFunc(format, func(token string) string {
+		return fmt.Sprintf("%0*d", len(token)-2, sequence)
+	})
+	number = strings.ReplaceAll(number, "{YYYY}", fmt.Sprintf("%04d", year))
+	return strings.ReplaceAll(number, "{YY}", fmt.Sprintf("%02d", year%100))
+}
+
+// AssignInternalNumber gives the invoice the next number of its company's fiscal year.
+// It must run in the transaction that completes the invoice, so that an invoice
+// that fails to complete does not leave a gap.
+func AssignInternalNumber(tx *gorm.DB, invoice *Invoice, format string) error {
+	if invoice.Sequence != 0 {
+		return nil
+	}
+
+	year := invoice.Date.Year()
+	// Incrementing first takes the write lock, so concurrent completions cannot get the same number
+	result := tx.Model(&DocumentSequence{}).Where("company_id = ? AND year = ?", invoice.CompanyID, year).Update("last", gorm.Expr("last + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.Create(&DocumentSequence{CompanyID: invoice.CompanyID, Year: year, Last: 1}).Error; err != nil {
+			return err
+		}
+	}
+
+	var sequence DocumentSequence
+	if err := tx.First(&sequence, "company_id = ? AND year = ?", invoice.CompanyID, year).Error; err != nil {
+		return err
+	}
+
+	invoice.FiscalYear = year
+	invoice.Sequence = sequence.Last
+	invoice.InternalNumber = FormatNumber(format, year, sequence.Last)
+	return nil
+}
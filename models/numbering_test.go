@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		format   string
+		year     int
+		sequence int
+		want     string
+	}{
+		{"", 2026, 45, "K-0045/2026"},
+		{DefaultNumberFormat, 2026, 12345, "K-12345/2026"},
+		{"{NN}/{YY}", 2026, 7, "07/26"},
+		{"KAL{NNNNNN}", 2026, 3, "KAL000003"},
+		{"{YYYY}-{NNN}", 2009, 1, "2009-001"},
+	}
+	for _, tt := range tests {
+		if got := FormatNumber(tt.format, tt.year, tt.sequence); got != tt.want {
+			t.Errorf("FormatNumber(%q, %d, %d) = %q, want %q", tt.format, tt.year, tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestAssignInternalNumber(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&DocumentSequence{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		invoice Invoice
+		want    string
+	}{
+		{"first of the year", Invoice{CompanyID: 1, Date: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)}, "K-0001/2026"},
+		{"next of the year", Invoice{CompanyID: 1, Date: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}, "K-0002/2026"},
+		{"new fiscal year", Invoice{CompanyID: 1, Date: time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC)}, "K-0001/2027"},
+		{"other company", Invoice{CompanyID: 2, Date: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)}, "K-0001/2026"},
+		{"already numbered", Invoice{CompanyID: 1, Date: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), FiscalYear: 2026, Sequence: 9, InternalNumber: "K-0009/2026"}, "K-0009/2026"},
+		{"after a numbered one", Invoice{CompanyID: 1, Date: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)}, "K-0003/2026"},
+	}
+	for _, tt := range tests {
+		invoice := tt.invoice
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return AssignInternalNumber(tx, &invoice, DefaultNumberFormat)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if invoice.InternalNumber != tt.want {
+			t.Errorf("%s: number = %q, want %q", tt.name, invoice.InternalNumber, tt.want)
+		}
+		if invoice.FiscalYear != invoice.Date.Year() {
+			t.Errorf("%s: fiscal year = %d, want %d", tt.name, invoice.FiscalYear, invoice.Date.Year())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payment methods offered when recording a payment
+var PaymentMethods = []string{"virman", "gotovina", "kartica", "kompenzacija"}
+
+// ValidPaymentMethod reports whether the method is one of PaymentMethods
+func ValidPaymentMethod(method string) bool {
+	for _, m := range PaymentMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment is a full or partial payment of a supplier invoice
+type Payment struct {
+	gorm.Model
+	InvoiceID uint      `gorm:"not null;index" json:"invoice_id"`
+	Date      time.Time `form:"-" json:"date"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference"` // Poziv na broj or other payment reference
+}
+
+// Aging buckets of overdue amounts, by days past the due date
+var AgingBuckets = []string{"0-30", "31-60", "61-90", "90+"}
+
+// AgingBucket returns the index into AgingBuckets for an invoice overdue by the given number of days
+func AgingBucket(daysOverdue int) int {
+	switch {
+	case daysOverdue <= 30:
+		return 0
+	case daysOverdue <= 60:
+		return 1
+	case daysOverdue <= 90:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// SupplierValue returns the line value as charged by the supplier, including the supplier's VAT
+func (ii InvoiceItem) SupplierValue() float64 {
+	return ii.Price * (1 - ii.Discount/100) * ii.Quantity * (1 + ii.TaxRate/100)
+}
+
+// Paid returns the sum of the invoice's payments, which must be loaded
+func (i Invoice) Paid() float64 {
+	paid := 0.0
+	for _, payment := range i.Payments {
+		paid += payment.Amount
+	}
+	return paid
+}
+
+// Outstanding returns the amount still owed to the supplier
+func (i Invoice) Outstanding() float64 {
+	outstanding := i.SupplierTotal - i.Paid()
+	// Ignore rounding leftovers
+	if math.Abs(outstanding) < 0.005 {
+		return 0
+	}
+	return outstanding
+}
+
+// DaysOverdue returns the number of days past the due date at the given time, zero when not yet due
+func (i Invoice) DaysOverdue(at time.Time) int {
+	if i.DueDate == nil {
+		return 0
+	}
+	due := time.Date(i.DueDate.Year(), i.DueDate.Month(), i.DueDate.Day(), 0, 0, 0, 0, at.Location())
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	if !day.After(due) {
+		return 0
+	}
+	return int(day.Sub(due).Hours() / 24)
+}
+
+// DefaultDueDate returns the invoice date moved by the supplier's payment term
+func DefaultDueDate(db *gorm.DB, supplierID uint, date time.Time) *time.Time {
+	var supplier Supplier
+	days := 0
+	if err := db.First(&supplier, supplierID).Error; err == nil {
+		days = supplier.PaymentTermDays
+	}
+	due := date.AddDate(0, 0, days)
+	return &due
+}
+
+// Statuses of imported bank transactions
+const (
+	TransactionMatched   = "matched"   // Recorded as a payment
+	TransactionSuggested = "suggested" // A likely invoice was found and waits for confirmation
+	TransactionUnmatched = "unmatched" // No invoice found, to be paired by hand
+	TransactionIgnored   = "ignored"   // Not a supplier invoice payment
+)
+
+// BankTransaction is an outgoing payment read from a bank statement
+type BankTransaction struct {
+	gorm.Model
+	CompanyID uint      `gorm:"index" json:"company_id"`
+	Date      time.Time `json:"date"`
+	Amount    float64   `json:"amount"`
+	Name      string    `json:"name"`
+	Account   string    `json:"account"`
+	PIB       string    `json:"pib"`
+	Reference string    `json:"reference"`
+	Purpose   string    `json:"purpose"`
+	Status    string    `gorm:"index" json:"status"`
+	InvoiceID *uint     `json:"invoice_id"` // Matched or suggested invoice
+	Invoice   *Invoice  `json:"invoice"`
+	PaymentID *uint     `json:"payment_id"`
+	Score     int       `json:"score"`
+	Reasons   string    `json:"reasons"` // What the match was based on
+}
+
+// SuggestedInvoiceID returns the matched or suggested invoice, or 0 when there is none
+func (t BankTransaction) SuggestedInvoiceID() uint {
+	if t.InvoiceID == nil {
+		return 0
+	}
+	return *t.InvoiceID
+}
@@ -0,0 +1,39 @@
+package models
+
+import "gorm.io/gorm"
+
+// OrderedLines orders invoice lines by their position, for use with Preload("LineItems", OrderedLines)
+func OrderedLines(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// NextLinePosition returns the position after the last line of the invoice,
+// counting imported lines still waiting to be paired
+func NextLinePosition(db *gorm.DB, invoiceID uint) (int, error) {
+	var last int
+	err := db.Raw(`SELECT MAX(position) FROM (
+		SELECT COALESCE(MAX(position), 0) AS position FROM invoice_items WHERE invoice_id = ?
+		UNION ALL SELECT COALESCE(MAX(position), 0) FROM import_lines WHERE invoice_id = ? AND deleted_at IS NULL)`,
+		invoiceID, invoiceID).Scan(&last).Error
+	return last + 1, err
+}
+
+// BeforeCreate appends new lines to the end of the invoice unless a position is given
+func (ii *InvoiceItem) BeforeCreate(tx *gorm.DB) error {
+	if ii.Position != 0 {
+		return nil
+	}
+	position, err := NextLinePosition(tx, ii.InvoiceID)
+	ii.Position = position
+	return err
+}
+
+// BeforeCreate reserves the line's place on the invoice in the order of the supplier document
+func (il *ImportLine) BeforeCreate(tx *gorm.DB) error {
+	if il.Position != 0 {
+		return nil
+	}
+	position, err := NextLinePosition(tx, il.InvoiceID)
+	il.Position = position
+	return err
+}
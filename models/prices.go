@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceDay is the day a price is valid from. Prices change per day whatever their source,
+// of several prices for the same day the last one recorded applies.
+func PriceDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RecordPrice stores a new selling price of an item valid from the day of validFrom. When the
+// price is the latest one, Item.Price is updated as well so it always holds the current price.
+func RecordPrice(db *gorm.DB, itemID uint, price float64, validFrom time.Time, source string) error {
+	validFrom = PriceDay(validFrom)
+	itemPrice := ItemPrice{
+		ItemID:    itemID,
+		Price:     price,
+		ValidFrom: validFrom,
+		Source:    source,
+	}
+	if err := db.Create(&itemPrice).Error; err != nil {
+		return err
+	}
+
+	var newer int64
+	if err := db.Model(&ItemPrice{}).Where("item_id = ? AND valid_from > ?", itemID, validFrom).Count(&newer).Error; err != nil {
+		return err
+	}
+	if newer > 0 {
+		return nil
+	}
+	return db.Model(&Item{}).Where("id = ?", itemID).Update("price", price).Error
+}
+
+// PriceAt returns the selling price of an item valid on the day of the given moment.
+// Before the first recorded price the earliest known price is used,
+// items without price history fall back to their current price.
+func PriceAt(db *gorm.DB, item Item, at time.Time) (float64, error) {
+	var itemPrice ItemPrice
+	err := db.Where("item_id = ? AND valid_from <= ?", item.ID, PriceDay(at)).Order("valid_from DESC, id DESC").First(&itemPrice).Error
+	if err == gorm.ErrRecordNotFound {
+		err = db.Where("item_id = ?", item.ID).Order("valid_from, id").First(&itemPrice).Error
+	}
+	if err == gorm.ErrRecordNotFound {
+		return item.Price, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return itemPrice.Price, nil
+}
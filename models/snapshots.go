@@ -0,0 +1,187 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CompanySnapshot is the company header as it was when an invoice was posted
+type CompanySnapshot struct {
+	Code               string `json:"code"`
+	RegistrationNumber string `json:"registration_number"`
+	SectorCode         string `json:"sector_code"`
+	Sector             string `json:"sector"`
+	Name               string `json:"name"`
+	Address            string `json:"address"`
+	Owner              string `json:"owner"`
+	User               string `json:"user"`
+	VatPayer           bool   `json:"vat_payer"`
+	LocationName       string `json:"location_name"`
+	LocationAddress    string `json:"location_address"`
+}
+
+// SupplierSnapshot holds the supplier details printed on a posted invoice
+type SupplierSnapshot struct {
+	Name               string `json:"name"`
+	Code               string `json:"code"`
+	PIB                string `json:"pib"`
+	RegistrationNumber string `json:"registration_number"`
+	Address            string `json:"address"`
+	PostalCode         string `json:"postal_code"`
+	City               string `json:"city"`
+}
+
+// HasSnapshot reports whether the invoice was posted with frozen company and supplier details
+func (i Invoice) HasSnapshot() bool {
+	return i.PostedCompany.Name != "" || i.PostedSupplier.Name != ""
+}
+
+// TakeSnapshot freezes the company header, the location and the supplier details on the invoice.
+// The location has to be loaded. A snapshot is taken only once, completing the invoice again
+// keeps the data it was first posted with.
+func (i *Invoice) TakeSnapshot(company Company, supplier Supplier) {
+	if i.HasSnapshot() {
+		return
+	}
+	i.PostedCompany = CompanySnapshot{
+		Code:               company.Code,
+		RegistrationNumber: company.RegistrationNumber,
+		SectorCode:         company.SectorCode,
+		Sector:             company.Sector,
+		Name:               company.Name,
+		Address:            company.Address,
+		Owner:              company.Owner,
+		User:               company.User,
+		VatPayer:           company.VatPayer,
+	}
+	if i.Location != nil {
+		i.PostedCompany.LocationName = i.Location.Name
+		i.PostedCompany.LocationAddress = i.Location.Address
+	}
+	i.PostedSupplier = SupplierSnapshot{
+		Name:               supplier.Name,
+		Code:               supplier.Code,
+		PIB:                supplier.PIB,
+		RegistrationNumber: supplier.RegistrationNumber,
+		Address:            supplier.Address,
+		PostalCode:         supplier.PostalCode,
+		City:               supplier.City,
+	}
+}
+
+// ApplySnapshot replaces the current company and supplier data with the data the invoice was
+// posted with, so reprints match the original. Drafts keep the current data.
+func (i *Invoice) ApplySnapshot(company *Company) {
+	if !i.HasSnapshot() {
+		return
+	}
+	posted := i.PostedCompany
+	company.Code = posted.Code
+	company.RegistrationNumber = posted.RegistrationNumber
+	company.SectorCode = posted.SectorCode
+	company.Sector = posted.Sector
+	company.Name = posted.Name
+	company.Address = posted.Address
+	company.Owner = posted.Owner
+	company.User = posted.User
+	company.VatPayer = posted.VatPayer
+	if i.Location != nil {
+		i.Location.Name = posted.LocationName
+		i.Location.Address = posted.LocationAddress
+	}
+
+	supplier := i.PostedSupplier
+	i.Supplier.Name = supplier.Name
+	i.Supplier.Code = supplier.Code
+	i.Supplier.PIB = supplier.PIB
+	i.Supplier.RegistrationNumber = supplier.RegistrationNumber
+	i.Supplier.Address = supplier.Address
+	i.Supplier.PostalCode = supplier.PostalCode
+	i.Supplier.City = supplier.City
+}
+
+// ImageVersion is an unchanging copy of a company image printed on posted invoices. Uploading a
+// new picture does not touch it, invoices posted with the same picture share one version.
+type ImageVersion struct {
+	ID          uint      `gorm:"primaryKey" json:"ID"`
+	CreatedAt   time.Time `json:"created_at"`
+	CompanyID   uint      `gorm:"not null;index:idx_image_version" json:"company_id"`
+	Kind        string    `gorm:"size:16;not null;index:idx_image_version" json:"kind"`
+	Checksum    string    `gorm:"size:64;not null;index:idx_image_version" json:"checksum"` // SHA-256 of the data
+	ContentType string    `gorm:"size:64" json:"content_type"`
+	Data        []byte    `json:"-"`
+}
+
+// PostedImage is a company image with the place and size it had when the invoice was posted
+type PostedImage struct {
+	ID             uint         `gorm:"primaryKey" json:"ID"`
+	InvoiceID      uint         `gorm:"not null;uniqueIndex:idx_posted_image" json:"invoice_id"`
+	Kind           string       `gorm:"size:16;not null;uniqueIndex:idx_posted_image" json:"kind"`
+	ImageVersionID uint         `gorm:"not null" json:"image_version_id"`
+	ImageVersion   ImageVersion `json:"-"`
+	Position       string       `gorm:"size:16" json:"position"`
+	Height         float64      `json:"height"`
+}
+
+// SnapshotImages freezes the current company images on the invoice. It runs together with
+// TakeSnapshot, when the invoice is first posted.
+func SnapshotImages(db *gorm.DB, invoiceID, companyID uint) error {
+	images, err := CompanyImages(db, companyID)
+	if err != nil {
+		return err
+	}
+	for kind, image := range images {
+		sum := sha256.Sum256(image.Data)
+		version := ImageVersion{CompanyID: companyID, Kind: kind, Checksum: hex.EncodeToString(sum[:])}
+		err := db.Where(&version).Attrs(ImageVersion{ContentType: image.ContentType, Data: image.Data}).FirstOrCreate(&version).Error
+		if err != nil {
+			return err
+		}
+		posted := PostedImage{InvoiceID: invoiceID, Kind: kind, ImageVersionID: version.ID, Position: image.Position, Height: image.Height}
+		if err := db.Create(&posted).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvoiceImages returns the images the invoice is printed with: the frozen ones of a posted
+// invoice, the current company images otherwise. The picture data is loaded only when asked for.
+func InvoiceImages(db *gorm.DB, invoice Invoice, withData bool) (map[string]CompanyImage, error) {
+	if !invoice.HasSnapshot() {
+		if !withData {
+			db = db.Omit("Data")
+		}
+		return CompanyImages(db, invoice.CompanyID)
+	}
+
+	var posted []PostedImage
+	err := db.Preload("ImageVersion", func(tx *gorm.DB) *gorm.DB {
+		if !withData {
+			return tx.Omit("Data")
+		}
+		return tx
+	}).Where("invoice_id = ?", invoice.ID).Find(&posted).Error
+	if err != nil {
+		return nil, err
+	}
+	byKind := make(map[string]CompanyImage, len(posted))
+	for _, p := range posted {
+		image := CompanyImage{
+			CompanyID:   invoice.CompanyID,
+			Kind:        p.Kind,
+			ContentType: p.ImageVersion.ContentType,
+			Data:        p.ImageVersion.Data,
+			Position:    p.Position,
+			Height:      p.Height,
+		}
+		image.ID = p.ImageVersionID
+		image.CreatedAt = p.ImageVersion.CreatedAt
+		image.UpdatedAt = p.ImageVersion.CreatedAt
+		byKind[p.Kind] = image
+	}
+	return byKind, nil
+}
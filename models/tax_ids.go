@@ -0,0 +1,164 @@
+package models
+
+import (
+	"math/big"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// ValidPIB checks a Serbian tax identification number: 9 digits, the last being an
+// ISO 7064 MOD 11,10 check digit
+func ValidPIB(pib string) bool {
+	pib = strings.TrimSpace(pib)
+	if !allDigits(pib, 9) {
+		return false
+	}
+	product := 10
+	for _, r := range pib[:8] {
+		sum := (product + int(r-'0')) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (2 * sum) % 11
+	}
+	return (11-product)%10 == int(pib[8]-'0')
+}
+
+// ValidMaticniBroj checks a company registration number: 8 digits, the last being a
+// mod 11 check digit over the first seven weighted 2, 7, 6, 5, 4, 3, 2. A remainder of 0
+// gives check digit 0, numbers with a remainder of 1 are not issued.
+func ValidMaticniBroj(mb string) bool {
+	mb = strings.TrimSpace(mb)
+	if !allDigits(mb, 8) {
+		return false
+	}
+	weights := [7]int{2, 7, 6, 5, 4, 3, 2}
+	sum := 0
+	for i, r := range mb[:7] {
+		sum += int(r-'0') * weights[i]
+	}
+	check := 0
+	switch remainder := sum % 11; remainder {
+	case 0:
+	case 1:
+		return false
+	default:
+		check = 11 - remainder
+	}
+	return check == int(mb[7]-'0')
+}
+
+// NormalizeBankAccount converts an account number written as 160-5100-05, 160000000000510005
+// or as an IBAN such as RS35 1600 0000 0000 5100 05 into its 18 digit form, padding the middle
+// part with zeros. An IBAN with wrong check digits is returned unchanged.
+func NormalizeBankAccount(account string) string {
+	account = strings.ReplaceAll(strings.TrimSpace(account), " ", "")
+	if iban := strings.ToUpper(account); strings.HasPrefix(iban, "RS") {
+		if allDigits(iban[2:], 20) && validIBAN(iban) {
+			return iban[4:]
+		}
+		return account
+	}
+	parts := strings.Split(account, "-")
+	if len(parts) != 3 {
+		return account
+	}
+	middle := parts[1]
+	if len(middle) < 13 {
+		middle = strings.Repeat("0", 13-len(middle)) + middle
+	}
+	return parts[0] + middle + parts[2]
+}
+
+// ValidBankAccount checks an 18 digit account number: 3 digit bank code, 13 digit account
+// and a 2 digit ISO 7064 MOD 97-10 check number
+func ValidBankAccount(account string) bool {
+	account = strings.TrimSpace(account)
+	if !allDigits(account, 18) {
+		return false
+	}
+	n, ok := new(big.Int).SetString(account, 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validIBAN checks the ISO 13616 check digits of an IBAN: with the country code and check digits
+// moved to the end and letters replaced by 10 to 35, the number modulo 97 must be 1
+func validIBAN(iban string) bool {
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// FormatBankAccount writes an 18 digit account number as 160-0000000510075-xx
+func FormatBankAccount(account string) string {
+	if len(account) != 18 {
+		return account
+	}
+	return account[:3] + "-" + account[3:16] + "-" + account[16:]
+}
+
+func allDigits(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// TrimIdentifiers removes the spaces around identifiers pasted into the form
+func (s *Supplier) TrimIdentifiers() {
+	s.PIB = strings.TrimSpace(s.PIB)
+	s.RegistrationNumber = strings.TrimSpace(s.RegistrationNumber)
+	s.Email = strings.TrimSpace(s.Email)
+}
+
+// Validate returns the problems with the supplier's tax identifiers keyed by form field.
+// Like the registration number the PIB is optional, suppliers from abroad have none.
+func (s Supplier) Validate() map[string]string {
+	errors := make(map[string]string)
+	if strings.TrimSpace(s.PIB) != "" && !ValidPIB(s.PIB) {
+		errors["PIB"] = "PIB mora imati 9 cifara sa ispravnom kontrolnom cifrom"
+	}
+	if s.RegistrationNumber != "" && !ValidMaticniBroj(s.RegistrationNumber) {
+		errors["RegistrationNumber"] = "Matični broj mora imati 8 cifara sa ispravnom kontrolnom cifrom"
+	}
+	if s.Email != "" {
+		if _, err := mail.ParseAddress(s.Email); err != nil {
+			errors["Email"] = "Neispravna e-mail adresa"
+		}
+	}
+	if s.PaymentTermDays < 0 {
+		errors["PaymentTermDays"] = "Rok plaćanja ne može biti negativan"
+	}
+	return errors
+}
+
+// TrimIdentifiers removes the spaces around identifiers pasted into the form
+func (c *Company) TrimIdentifiers() {
+	c.Code = strings.TrimSpace(c.Code)
+	c.RegistrationNumber = strings.TrimSpace(c.RegistrationNumber)
+}
+
+// Validate returns the problems with the company's tax identifiers keyed by form field
+func (c Company) Validate() map[string]string {
+	errors := make(map[string]string)
+	if !ValidPIB(c.Code) {
+		errors["Code"] = "PIB mora imati 9 cifara sa ispravnom kontrolnom cifrom"
+	}
+	if c.RegistrationNumber != "" && !ValidMaticniBroj(c.RegistrationNumber) {
+		errors["RegistrationNumber"] = "Matični broj mora imati 8 cifara sa ispravnom kontrolnom cifrom"
+	}
+	return errors
+}
@@ -0,0 +1,83 @@
+package models
+
+import "testing"
+
+func TestValidPIB(t *testing.T) {
+	tests := []struct {
+		pib  string
+		want bool
+	}{
+		{"101134702", true},
+		{"100002887", true},
+		{" 101134702 ", true},
+		{"101134703", false}, // wrong check digit
+		{"10113470", false},  // too short
+		{"1011347020", false},
+		{"10113470a", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidPIB(tt.pib); got != tt.want {
+			t.Errorf("ValidPIB(%q) = %v, want %v", tt.pib, got, tt.want)
+		}
+	}
+}
+
+func TestValidMaticniBroj(t *testing.T) {
+	tests := []struct {
+		mb   string
+		want bool
+	}{
+		{"17162543", true},
+		{"07001541", true},
+		{"20727640", true}, // remainder 0 gives check digit 0
+		{" 17162543", true},
+		{"17162544", false}, // wrong check digit
+		{"00000060", false}, // remainder 1 is never issued
+		{"00000061", false},
+		{"1716254", false},
+		{"1716254x", false},
+	}
+	for _, tt := range tests {
+		if got := ValidMaticniBroj(tt.mb); got != tt.want {
+			t.Errorf("ValidMaticniBroj(%q) = %v, want %v", tt.mb, got, tt.want)
+		}
+	}
+}
+
+func TestValidBankAccount(t *testing.T) {
+	tests := []struct {
+		account string
+		want    bool
+	}{
+		{"160000000000510005", true},
+		{"160000000000510006", false}, // wrong check number
+		{"16000000000051000", false},
+		{"160-5100-05", false}, // has to be normalized first
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidBankAccount(tt.account); got != tt.want {
+			t.Errorf("ValidBankAccount(%q) = %v, want %v", tt.account, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeBankAccount(t *testing.T) {
+	tests := []struct {
+		account string
+		want    string
+	}{
+		{"160-5100-05", "160000000000510005"},
+		{"160000000000510005", "160000000000510005"},
+		{"RS35160000000000510005", "160000000000510005"},
+		{"rs35 1600 0000 0000 5100 05", "160000000000510005"},
+		{"RS36160000000000510005", "RS36160000000000510005"}, // wrong IBAN check digits
+		{"160-5100", "160-5100"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeBankAccount(tt.account); got != tt.want {
+			t.Errorf("NormalizeBankAccount(%q) = %q, want %q", tt.account, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+// Tables whose records belong to a company. Invoice lines, payments, supplier item codes and
+// bank accounts belong to the company of their parent record. VAT rates are set by law and
+// shared by all companies.
+var tenantTables = []string{"items", "suppliers", "invoices", "locations", "bank_transactions", "document_sequences"}
+
+// AssignOrphans gives records stored before they belonged to a company to the given company
+func AssignOrphans(db *gorm.DB, companyID uint) error {
+	for _, table := range tenantTables {
+		err := db.Exec("UPDATE "+table+" SET company_id = ? WHERE company_id IS NULL OR company_id = 0", companyID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultVatRates are the rates in force when the rate table was introduced
+var defaultVatRates = []VatRate{
+	{Code: "opsta", Name: "Opšta stopa", Percent: 20, Label: "Ђ"},
+	{Code: "posebna", Name: "Posebna stopa", Percent: 10, Label: "Е"},
+	{Code: "van-pdv", Name: "Nije u sistemu PDV", Percent: 0, Label: "А", Exempt: true},
+	{Code: "oslobodjeno", Name: "Oslobođeno PDV", Percent: 0, Label: "Г", Exempt: true},
+}
+
+// LoadVatRates returns all configured rates, newest validity first
+func LoadVatRates(db *gorm.DB) ([]VatRate, error) {
+	var rates []VatRate
+	err := db.Order("code, valid_from DESC").Find(&rates).Error
+	return rates, err
+}
+
+// CurrentVatRates returns the rates that can be assigned on the given date
+func CurrentVatRates(db *gorm.DB, at time.Time) ([]VatRate, error) {
+	rates, err := LoadVatRates(db)
+	if err != nil {
+		return nil, err
+	}
+	var current []VatRate
+	for _, rate := range rates {
+		if rate.ValidAt(at) {
+			current = append(current, rate)
+		}
+	}
+	return current, nil
+}
+
+// VatRateAt returns the rate with the same code as the given one that applies on the given date.
+// When no period covers the date the given rate is returned unchanged.
+func VatRateAt(db *gorm.DB, rate VatRate, at time.Time) (VatRate, error) {
+	if rate.ID == 0 || rate.ValidAt(at) {
+		return rate, nil
+	}
+
+	var rates []VatRate
+	if err := db.Where("code = ?", rate.Code).Find(&rates).Error; err != nil {
+		return rate, err
+	}
+	for _, r := range rates {
+		if r.ValidAt(at) {
+			return r, nil
+		}
+	}
+	return rate, nil
+}
+
+// VatRateByLabel finds the rate with the given register letter valid on the given date
+func VatRateByLabel(rates []VatRate, label string, at time.Time) (VatRate, bool) {
+	for _, rate := range rates {
+		if rate.Label == label && rate.ValidAt(at) {
+			return rate, true
+		}
+	}
+	return VatRate{}, false
+}
+
+func seedVatRates(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&VatRate{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	rates := make([]VatRate, len(defaultVatRates))
+	copy(rates, defaultVatRates)
+	return db.Create(&rates).Error
+}
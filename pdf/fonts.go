@@ -0,0 +1,138 @@
+package pdf
+
+import "strings"
+
+// Helvetica and Helvetica-Bold glyph widths for the printable ASCII range, in 1/1000 of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// Serbian Latin letters outside WinAnsiEncoding are placed on unused codes through the font's
+// Differences array. Š, š, Ž and ž are already part of WinAnsiEncoding.
+var specialCodes = map[rune]byte{
+	'Č': 0x81, 'č': 0x8D, 'Ć': 0x8F, 'ć': 0x90, 'Đ': 0x9D, 'đ': 0xF0,
+	'Š': 0x8A, 'š': 0x9A, 'Ž': 0x8E, 'ž': 0x9E,
+	'€': 0x80, '–': 0x96, '—': 0x97, '„': 0x84, '“': 0x93, '”': 0x94, '’': 0x92, '•': 0x95,
+}
+
+// baseLetters gives the letter used for measuring the width of accented characters
+var baseLetters = map[rune]rune{
+	'Č': 'C', 'č': 'c', 'Ć': 'C', 'ć': 'c', 'Đ': 'D', 'đ': 'd', 'Š': 'S', 'š': 's', 'Ž': 'Z', 'ž': 'z',
+	'–': '-', '—': 'M', '„': ',', '“': '"', '”': '"', '’': '\'', '•': 'o',
+}
+
+// Cyrillic is printed transliterated to Serbian Latin, the built-in fonts have no Cyrillic glyphs
+var cyrillic = map[rune]string{
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Ђ': "Đ", 'Е': "E", 'Ж': "Ž", 'З': "Z", 'И': "I",
+	'Ј': "J", 'К': "K", 'Л': "L", 'Љ': "Lj", 'М': "M", 'Н': "N", 'Њ': "Nj", 'О': "O", 'П': "P", 'Р': "R",
+	'С': "S", 'Т': "T", 'Ћ': "Ć", 'У': "U", 'Ф': "F", 'Х': "H", 'Ц': "C", 'Ч': "Č", 'Џ': "Dž", 'Ш': "Š",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'ђ': "đ", 'е': "e", 'ж': "ž", 'з': "z", 'и': "i",
+	'ј': "j", 'к': "k", 'л': "l", 'љ': "lj", 'м': "m", 'н': "n", 'њ': "nj", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'ћ': "ć", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c", 'ч': "č", 'џ': "dž", 'ш': "š",
+}
+
+func encodingDictionary() string {
+	return "<< /Type /Encoding /BaseEncoding /WinAnsiEncoding " +
+		"/Differences [129 /Ccaron 141 /ccaron 143 /Cacute 144 /cacute 157 /Dcroat 240 /dcroat] >>"
+}
+
+// Transliterate replaces Cyrillic letters with their Serbian Latin equivalents
+func Transliterate(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if latin, ok := cyrillic[r]; ok {
+			sb.WriteString(latin)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// encode converts text to the single byte font encoding
+func encode(s string) string {
+	s = Transliterate(s)
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f:
+			out = append(out, byte(r))
+		case specialCodes[r] != 0:
+			out = append(out, specialCodes[r])
+		case r >= 0xa0 && r <= 0xff && r != 0xf0:
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return string(out)
+}
+
+// TextWidth returns the width of s in points
+func TextWidth(s string, size float64, bold bool) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, r := range Transliterate(s) {
+		if base, ok := baseLetters[r]; ok {
+			r = base
+		}
+		if r >= 0x20 && r < 0x7f {
+			total += widths[r-0x20]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Fit shortens s so that it fits into the given width
+func Fit(s string, width, size float64, bold bool) string {
+	if TextWidth(s, size, bold) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && TextWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// Wrap splits s into lines no wider than the given width
+func Wrap(s string, width, size float64, bold bool) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && TextWidth(candidate, size, bold) > width {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
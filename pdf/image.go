@@ -0,0 +1,110 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Image is a picture embedded once in the document that can be drawn on any of its pages
+type Image struct {
+	// Size in pixels
+	Width  int
+	Height int
+
+	name       string
+	colorSpace string
+	filter     string
+	data       []byte
+	// Compressed alpha channel, nil for opaque pictures
+	alpha []byte
+}
+
+// AddImage embeds a PNG or JPEG picture into the document. JPEG files are embedded as they are,
+// everything else is stored as compressed RGB with the transparency kept as a soft mask.
+func (d *Document) AddImage(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	img := &Image{Width: config.Width, Height: config.Height, name: fmt.Sprintf("Im%d", len(d.images)+1)}
+
+	// CMYK JPEG files are usually stored inverted, they are converted like PNG files
+	if format == "jpeg" && (config.ColorModel == color.YCbCrModel || config.ColorModel == color.GrayModel) {
+		img.filter = "/DCTDecode"
+		img.colorSpace = "/DeviceRGB"
+		if config.ColorModel == color.GrayModel {
+			img.colorSpace = "/DeviceGray"
+		}
+		img.data = data
+	} else if err := img.convert(data); err != nil {
+		return nil, err
+	}
+
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// convert decodes the picture and stores its RGB samples and alpha channel
+func (img *Image) convert(data []byte) error {
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unsupported image: %v", err)
+	}
+
+	bounds := decoded.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 0xff {
+				opaque = false
+			}
+		}
+	}
+
+	img.filter, img.colorSpace = "/FlateDecode", "/DeviceRGB"
+	if img.data, err = deflate(rgb); err != nil {
+		return err
+	}
+	if !opaque {
+		if img.alpha, err = deflate(alpha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScaledWidth returns the width of the picture drawn at the given height, keeping its proportions
+func (img *Image) ScaledWidth(height float64) float64 {
+	if img.Height == 0 {
+		return 0
+	}
+	return height * float64(img.Width) / float64(img.Height)
+}
+
+// Image draws the picture with its top left corner at x, y, scaled to the given height
+func (p *Page) Image(img *Image, x, y, height float64) {
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n",
+		img.ScaledWidth(height), height, x, p.doc.Height-y-height, img.name)
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
@@ -0,0 +1,178 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Page sizes in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Document is a minimal PDF writer using the built-in Helvetica fonts, so no font files are needed.
+// Coordinates are in points measured from the top left corner of the page.
+type Document struct {
+	Width  float64
+	Height float64
+	Title  string
+	pages  []*Page
+	images []*Image
+}
+
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+// AddPage appends a new empty page to the document
+func (d *Document) AddPage() *Page {
+	page := &Page{doc: d}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// Pages returns the pages added so far
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// Text writes s with its baseline starting at x, y
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.doc.Height-y, escape(encode(s)))
+}
+
+// TextRight writes s so that it ends at x
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size, bold), y, size, bold, s)
+}
+
+// TextCenter writes s centered around x
+func (p *Page) TextCenter(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size, bold)/2, y, size, bold, s)
+}
+
+// Line draws a line between two points
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, p.doc.Height-y1, x2, p.doc.Height-y2)
+}
+
+// Rect draws the outline of a rectangle whose top left corner is at x, y
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", width, x, p.doc.Height-y-h, w, h)
+}
+
+// FillRect fills a rectangle with a gray level between 0 (black) and 1 (white)
+func (p *Page) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.content, "%.2f g %.2f %.2f %.2f %.2f re f 0 g\n", gray, x, p.doc.Height-y-h, w, h)
+}
+
+// Bytes renders the complete document
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the complete document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+
+	// Objects are numbered in the order they are written, starting at 1
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		buf.Write(data)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Fixed objects: 1 catalog, 2 page tree, 3-4 fonts, 5 encoding, 6 info
+	pagesStart := 7
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pagesStart+i*2)
+	}
+
+	// Images follow the pages, each with its soft mask when it has one. Every page may use any of them.
+	var xobjects []string
+	next := pagesStart + len(d.pages)*2
+	for _, img := range d.images {
+		xobjects = append(xobjects, fmt.Sprintf("/%s %d 0 R", img.name, next))
+		next++
+		if img.alpha != nil {
+			next++
+		}
+	}
+	resources := "/Font << /F1 3 0 R /F2 4 0 R >>"
+	if len(xobjects) > 0 {
+		resources += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding 5 0 R >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding 5 0 R >>")
+	object(encodingDictionary())
+	object(fmt.Sprintf("<< /Title (%s) /Producer (invoicing) >>", escape(encode(d.Title))))
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << %s >> /Contents %d 0 R >>",
+			d.Width, d.Height, resources, pagesStart+i*2+1))
+
+		compressed, err := deflate(page.content.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		stream("/Filter /FlateDecode", compressed)
+	}
+
+	for _, img := range d.images {
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s",
+			img.Width, img.Height, img.colorSpace, img.filter)
+		if img.alpha != nil {
+			dict += fmt.Sprintf(" /SMask %d 0 R", len(offsets)+2)
+		}
+		stream(dict, img.data)
+		if img.alpha != nil {
+			stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+				img.Width, img.Height), img.alpha)
+		}
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "(", "\\(")
+	s = strings.ReplaceAll(s, ")", "\\)")
+	return s
+}
@@ -0,0 +1,89 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Statement exported from Halcom e-banking, the OFX based XML offered by most Serbian banks
+type pmtNotification struct {
+	Transactions []halcomTransaction `xml:"stmtrs>trnlist>stmttrn"`
+}
+
+type halcomTransaction struct {
+	Benefit        string `xml:"benefit"` // debit or credit
+	Amount         string `xml:"trnamt"`
+	Posted         string `xml:"dtposted"`
+	Name           string `xml:"payeeinfo>name"`
+	Account        string `xml:"payeeaccountinfo>acctid"`
+	Purpose        string `xml:"purpose"`
+	Model          string `xml:"refmodel"`
+	Reference      string `xml:"refnumber"`
+	PayeeModel     string `xml:"payeerefmodel"`
+	PayeeReference string `xml:"payeerefnumber"`
+}
+
+// ParseHalcom reads the bookings of a statement exported from Halcom e-banking. The counterparty
+// is listed as the payee of every booking, the reference is the one of the receiving side.
+func ParseHalcom(r io.Reader) ([]Transaction, error) {
+	var doc pmtNotification
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error reading statement: %v", err)
+	}
+
+	var transactions []Transaction
+	for _, tx := range doc.Transactions {
+		date, err := ParseDate(tx.Posted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid booking date: %v", err)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(tx.Amount), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q", tx.Amount)
+		}
+
+		// Some banks export debits as negative amounts instead of marking them
+		outgoing := strings.EqualFold(strings.TrimSpace(tx.Benefit), "debit") || amount < 0
+		reference := strings.TrimSpace(tx.PayeeModel + " " + tx.PayeeReference)
+		if strings.TrimSpace(tx.PayeeReference) == "" {
+			reference = strings.TrimSpace(tx.Model + " " + tx.Reference)
+		}
+		transactions = append(transactions, Transaction{
+			Date:      date,
+			Amount:    math.Abs(amount),
+			Outgoing:  outgoing,
+			Name:      strings.TrimSpace(tx.Name),
+			Account:   strings.TrimSpace(tx.Account),
+			Reference: reference,
+			Purpose:   strings.TrimSpace(tx.Purpose),
+		})
+	}
+	return transactions, nil
+}
+
+// ParseXML reads a camt.053 or Halcom statement, recognised by the root element
+func ParseXML(data []byte) ([]Transaction, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading statement: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(start.Name.Local) {
+		case "document":
+			return ParseCamt053(bytes.NewReader(data))
+		case "pmtnotification":
+			return ParseHalcom(bytes.NewReader(data))
+		}
+		return nil, fmt.Errorf("unknown statement format <%s>", start.Name.Local)
+	}
+}
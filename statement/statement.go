@@ -0,0 +1,132 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction is a single booking on a bank statement. Counterparty fields describe
+// the recipient of an outgoing payment or the payer of an incoming one.
+type Transaction struct {
+	Date      time.Time
+	Amount    float64
+	Outgoing  bool
+	Name      string
+	Account   string
+	PIB       string
+	Reference string // Poziv na broj
+	Purpose   string
+}
+
+// camt.053 bank to customer statement (ISO 20022), as issued by Serbian banks
+type document struct {
+	Statements []struct {
+		Entries []entry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type entry struct {
+	Amount       string `xml:"Amt"`
+	Indicator    string `xml:"CdtDbtInd"`
+	BookingDate  string `xml:"BookgDt>Dt"`
+	BookingTime  string `xml:"BookgDt>DtTm"`
+	ValueDate    string `xml:"ValDt>Dt"`
+	Info         string `xml:"AddtlNtryInf"`
+	Transactions []struct {
+		Amount         string   `xml:"AmtDtls>TxAmt>Amt"`
+		CreditorName   string   `xml:"RltdPties>Cdtr>Nm"`
+		CreditorPty    string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+		CreditorID     string   `xml:"RltdPties>Cdtr>Id>OrgId>Othr>Id"`
+		CreditorAcct   string   `xml:"RltdPties>CdtrAcct>Id>Othr>Id"`
+		CreditorIBAN   string   `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+		DebtorName     string   `xml:"RltdPties>Dbtr>Nm"`
+		DebtorPty      string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+		DebtorID       string   `xml:"RltdPties>Dbtr>Id>OrgId>Othr>Id"`
+		DebtorAcct     string   `xml:"RltdPties>DbtrAcct>Id>Othr>Id"`
+		DebtorIBAN     string   `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+		Reference      string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+		Unstructured   []string `xml:"RmtInf>Ustrd"`
+		AdditionalInfo string   `xml:"AddtlTxInf"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// ParseCamt053 reads the bookings of an ISO 20022 camt.053 statement
+func ParseCamt053(r io.Reader) ([]Transaction, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error reading statement: %v", err)
+	}
+
+	var transactions []Transaction
+	for _, stmt := range doc.Statements {
+		for _, e := range stmt.Entries {
+			date, err := ParseDate(first(e.BookingDate, e.BookingTime, e.ValueDate))
+			if err != nil {
+				return nil, fmt.Errorf("invalid booking date: %v", err)
+			}
+			outgoing := strings.EqualFold(strings.TrimSpace(e.Indicator), "DBIT")
+
+			// An entry without details is a single transaction
+			if len(e.Transactions) == 0 {
+				amount, err := strconv.ParseFloat(strings.TrimSpace(e.Amount), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid amount %q", e.Amount)
+				}
+				transactions = append(transactions, Transaction{Date: date, Amount: amount, Outgoing: outgoing, Purpose: strings.TrimSpace(e.Info)})
+				continue
+			}
+
+			for _, tx := range e.Transactions {
+				amount, err := strconv.ParseFloat(strings.TrimSpace(first(tx.Amount, e.Amount)), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid amount %q", first(tx.Amount, e.Amount))
+				}
+				t := Transaction{
+					Date:      date,
+					Amount:    amount,
+					Outgoing:  outgoing,
+					Reference: strings.TrimSpace(tx.Reference),
+					Purpose:   strings.TrimSpace(first(strings.Join(tx.Unstructured, " "), tx.AdditionalInfo, e.Info)),
+				}
+				if outgoing {
+					t.Name = first(tx.CreditorName, tx.CreditorPty)
+					t.Account = first(tx.CreditorAcct, tx.CreditorIBAN)
+					t.PIB = strings.TrimSpace(tx.CreditorID)
+				} else {
+					t.Name = first(tx.DebtorName, tx.DebtorPty)
+					t.Account = first(tx.DebtorAcct, tx.DebtorIBAN)
+					t.PIB = strings.TrimSpace(tx.DebtorID)
+				}
+				transactions = append(transactions, t)
+			}
+		}
+	}
+	return transactions, nil
+}
+
+// ParseDate accepts the ISO date and the local 02.01.2006 notation
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	if len(s) > 10 && s[4] == '-' {
+		s = s[:10]
+	}
+	for _, layout := range []string{"2006-01-02", "02.01.2006", "2.1.2006", "02/01/2006"} {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
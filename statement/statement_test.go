@@ -0,0 +1,133 @@
+package statement
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const camt053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Ntry>
+        <Amt Ccy="RSD">12500.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2026-03-05</Dt></BookgDt>
+        <NtryDtls>
+          <TxDtls>
+            <AmtDtls><TxAmt><Amt Ccy="RSD">12500.50</Amt></TxAmt></AmtDtls>
+            <RltdPties>
+              <Cdtr><Nm>Dobavljač DOO</Nm><Id><OrgId><Othr><Id>101134702</Id></Othr></OrgId></Id></Cdtr>
+              <CdtrAcct><Id><Othr><Id>160000000000510005</Id></Othr></Id></CdtrAcct>
+            </RltdPties>
+            <RmtInf>
+              <Ustrd>Placanje po racunu</Ustrd>
+              <Ustrd>F-12/2026</Ustrd>
+              <Strd><CdtrRefInf><Ref>97 1226</Ref></CdtrRefInf></Strd>
+            </RmtInf>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="RSD">300</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><DtTm>2026-03-06T10:15:00</DtTm></BookgDt>
+        <AddtlNtryInf>Povrat</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+const halcom = `<?xml version="1.0" encoding="UTF-8"?>
+<pmtnotification>
+  <stmtrs>
+    <trnlist>
+      <stmttrn>
+        <benefit>debit</benefit>
+        <trnamt>-1500.00</trnamt>
+        <dtposted>07.03.2026</dtposted>
+        <payeeinfo><name>Dobavljač DOO</name></payeeinfo>
+        <payeeaccountinfo><acctid>160-5100-05</acctid></payeeaccountinfo>
+        <purpose>Racun 45</purpose>
+        <payeerefmodel>97</payeerefmodel>
+        <payeerefnumber>4526</payeerefnumber>
+      </stmttrn>
+    </trnlist>
+  </stmtrs>
+</pmtnotification>`
+
+func TestParseCamt053(t *testing.T) {
+	transactions, err := ParseCamt053(strings.NewReader(camt053))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Transaction{
+		{
+			Date:      time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC),
+			Amount:    12500.50,
+			Outgoing:  true,
+			Name:      "Dobavljač DOO",
+			Account:   "160000000000510005",
+			PIB:       "101134702",
+			Reference: "97 1226",
+			Purpose:   "Placanje po racunu F-12/2026",
+		},
+		{
+			Date:    time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC),
+			Amount:  300,
+			Purpose: "Povrat",
+		},
+	}
+	if len(transactions) != len(want) {
+		t.Fatalf("got %d transactions, want %d", len(transactions), len(want))
+	}
+	for i := range want {
+		if transactions[i] != want[i] {
+			t.Errorf("transaction %d = %+v, want %+v", i, transactions[i], want[i])
+		}
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		count   int
+		wantErr bool
+	}{
+		{"camt.053", camt053, 2, false},
+		{"Halcom", halcom, 1, false},
+		{"unknown root", `<statement></statement>`, 0, true},
+		{"not XML", `datum;iznos`, 0, true},
+	}
+	for _, tt := range tests {
+		transactions, err := ParseXML([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(transactions) != tt.count {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(transactions), tt.count)
+		}
+	}
+}
+
+func TestParseHalcom(t *testing.T) {
+	transactions, err := ParseHalcom(strings.NewReader(halcom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Transaction{
+		Date:      time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC),
+		Amount:    1500,
+		Outgoing:  true,
+		Name:      "Dobavljač DOO",
+		Account:   "160-5100-05",
+		Reference: "97 4526",
+		Purpose:   "Racun 45",
+	}
+	if len(transactions) != 1 || transactions[0] != want {
+		t.Errorf("got %+v, want %+v", transactions, want)
+	}
+}
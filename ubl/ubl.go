@@ -0,0 +1,122 @@
+package ubl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Invoice holds the parts of a UBL 2.1 invoice (as exchanged through SEF) that we import
+type Invoice struct {
+	ID        string `xml:"ID"`
+	IssueDate string `xml:"IssueDate"`
+	DueDate   string `xml:"DueDate"`
+	Supplier  Party  `xml:"AccountingSupplierParty>Party"`
+	Lines     []Line `xml:"InvoiceLine"`
+}
+
+type Party struct {
+	EndpointID   string `xml:"EndpointID"`
+	Name         string `xml:"PartyName>Name"`
+	TaxCompanyID string `xml:"PartyTaxScheme>CompanyID"`
+	LegalName    string `xml:"PartyLegalEntity>RegistrationName"`
+	LegalID      string `xml:"PartyLegalEntity>CompanyID"`
+	Street       string `xml:"PostalAddress>StreetName"`
+	City         string `xml:"PostalAddress>CityName"`
+	PostalZone   string `xml:"PostalAddress>PostalZone"`
+}
+
+type Line struct {
+	ID                  string  `xml:"ID"`
+	Quantity            float64 `xml:"InvoicedQuantity"`
+	LineExtensionAmount float64 `xml:"LineExtensionAmount"`
+	Allowances          []struct {
+		ChargeIndicator bool    `xml:"ChargeIndicator"`
+		Percent         float64 `xml:"MultiplierFactorNumeric"`
+		Amount          float64 `xml:"Amount"`
+	} `xml:"AllowanceCharge"`
+	Name        string  `xml:"Item>Name"`
+	SellersCode string  `xml:"Item>SellersItemIdentification>ID"`
+	TaxCategory string  `xml:"Item>ClassifiedTaxCategory>ID"`
+	TaxPercent  float64 `xml:"Item>ClassifiedTaxCategory>Percent"`
+	Price       float64 `xml:"Price>PriceAmount"`
+	BaseQty     float64 `xml:"Price>BaseQuantity"`
+}
+
+// Parse reads a UBL invoice. SEF downloads wrap the invoice in a document
+// envelope, so the first Invoice element found anywhere in the file is used.
+func Parse(r io.Reader) (Invoice, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return Invoice{}, fmt.Errorf("no UBL Invoice element found")
+		}
+		if err != nil {
+			return Invoice{}, fmt.Errorf("error reading XML: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Invoice" {
+			continue
+		}
+
+		var invoice Invoice
+		if err := decoder.DecodeElement(&invoice, &start); err != nil {
+			return Invoice{}, fmt.Errorf("error parsing invoice: %v", err)
+		}
+		if invoice.ID == "" {
+			return Invoice{}, fmt.Errorf("invoice has no document number")
+		}
+		return invoice, nil
+	}
+}
+
+// Date returns the issue date of the invoice
+func (i Invoice) Date() (time.Time, error) {
+	return time.Parse("2006-01-02", strings.TrimSpace(i.IssueDate))
+}
+
+// PIB returns the seller's tax identification number without the "RS" prefix
+func (p Party) PIB() string {
+	pib := strings.TrimSpace(p.TaxCompanyID)
+	if pib == "" {
+		pib = strings.TrimSpace(p.EndpointID)
+	}
+	return strings.TrimPrefix(strings.ToUpper(pib), "RS")
+}
+
+// DisplayName returns the trading name, falling back to the registered name
+func (p Party) DisplayName() string {
+	if name := strings.TrimSpace(p.Name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(p.LegalName)
+}
+
+// UnitPrice returns the net price per single unit
+func (l Line) UnitPrice() float64 {
+	if l.BaseQty > 0 {
+		return l.Price / l.BaseQty
+	}
+	return l.Price
+}
+
+// Discount returns the line discount as a percentage of the line value
+func (l Line) Discount() float64 {
+	gross := l.UnitPrice() * l.Quantity
+	discount := 0.0
+	for _, a := range l.Allowances {
+		if a.ChargeIndicator {
+			continue
+		}
+		if a.Percent > 0 {
+			discount += a.Percent
+		} else if gross > 0 {
+			discount += a.Amount / gross * 100
+		}
+	}
+	return discount
+}
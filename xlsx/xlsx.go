@@ -0,0 +1,165 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type sharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadRows returns the cell values of the first worksheet in an XLSX file.
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("error opening workbook: %v", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var strs sharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode(f, &strs); err != nil {
+			return nil, fmt.Errorf("error reading shared strings: %v", err)
+		}
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet worksheet
+	if err := decode(files[sheetPath], &sheet); err != nil {
+		return nil, fmt.Errorf("error reading worksheet: %v", err)
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var values []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(strs.Items) {
+					return nil, fmt.Errorf("invalid shared string reference in cell %s", cell.Ref)
+				}
+				values[col] = sharedText(strs, idx)
+			case "inlineStr":
+				values[col] = cell.Inline
+			default:
+				values[col] = cell.Value
+			}
+		}
+		rows = append(rows, values)
+	}
+
+	return rows, nil
+}
+
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var wb workbook
+	var rels relationships
+	wbFile, ok := files["xl/workbook.xml"]
+	relsFile, relsOk := files["xl/_rels/workbook.xml.rels"]
+	if ok && relsOk && decode(wbFile, &wb) == nil && decode(relsFile, &rels) == nil && len(wb.Sheets) > 0 {
+		for _, rel := range rels.Items {
+			if rel.ID != wb.Sheets[0].RID {
+				continue
+			}
+			target := strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(target, "xl/") {
+				target = path.Join("xl", target)
+			}
+			if _, ok := files[target]; ok {
+				return target, nil
+			}
+		}
+	}
+
+	// Fall back to the conventional name of the first sheet
+	if _, ok := files["xl/worksheets/sheet1.xml"]; ok {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+	return "", fmt.Errorf("workbook has no worksheets")
+}
+
+func sharedText(strs sharedStrings, idx int) string {
+	item := strs.Items[idx]
+	if len(item.Runs) == 0 {
+		return item.Text
+	}
+	var sb strings.Builder
+	for _, run := range item.Runs {
+		sb.WriteString(run.Text)
+	}
+	return sb.String()
+}
+
+// columnIndex converts a cell reference such as "C12" into a zero based column index.
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
+
+func decode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}